@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sushi/service"
+	"text/tabwriter"
+	"time"
+)
+
+const apiKeyUsage = `usage: sushi apikey <command> [flags]
+
+commands:
+  list                              list the API keys
+  create -name NAME -scopes SCOPES  create a key with comma separated scopes:
+                                    earn, withdraw-process, read-only
+  revoke -id N                      stop a key from authenticating`
+
+// APIKey manages the API keys of machine clients like the game server and the tx server.
+func APIKey(env *Env, args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+	apiKeys := service.NewAPIKeyService(env.DB, env.Log)
+
+	switch args[0] {
+	case "list":
+		return listAPIKeys(apiKeys)
+	case "create":
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the client")
+		scopes := flags.String("scopes", "", "comma separated scopes")
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if *name == "" || *scopes == "" {
+			return errors.New(apiKeyUsage)
+		}
+		key, apiKey, err := apiKeys.CreateAPIKey(*name, strings.Split(*scopes, ","))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("api key %d (%s) created, it is only shown once:\n%s\n", apiKey.ID, apiKey.Name, key)
+		return nil
+	case "revoke":
+		flags := flag.NewFlagSet("revoke", flag.ContinueOnError)
+		id := flags.Uint("id", 0, "id of the key")
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		err = apiKeys.RevokeAPIKey(*id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("api key %d revoked\n", *id)
+		return nil
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
+
+func listAPIKeys(apiKeys *service.APIKeyService) error {
+	list, err := apiKeys.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tLAST USED\tREVOKED")
+	for _, apiKey := range list {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", apiKey.ID, apiKey.Name, apiKey.Prefix, apiKey.Scopes,
+			formatTime(apiKey.LastUsedAt), formatTime(apiKey.RevokedAt))
+	}
+	return w.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
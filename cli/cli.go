@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sushi/utils/DB"
+	"sushi/utils/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Command is an administrative subcommand run instead of the server, e.g. `sushi network list`.
+type Command func(env *Env, args []string) error
+
+var commands = map[string]Command{
+	"network": Network,
+	"token":   Token,
+	"apikey":  APIKey,
+}
+
+// Env holds what subcommands share: the config, a stdout logger and the database.
+type Env struct {
+	Config *config.Config
+	Log    *logrus.Logger
+	DB     *DB.DB
+}
+
+// IsCommand reports whether name is a CLI subcommand.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes the subcommand named by args[0].
+func Run(args []string) error {
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	conf, err := config.NewConfig()
+	if err != nil {
+		return fmt.Errorf("error reading config.yaml: %w", err)
+	}
+	log := logrus.New()
+	log.Out = os.Stderr
+	log.Level = conf.LogLevel()
+
+	db := DB.NewDB_MySQL(log, conf.DBConnectionPath())
+	if db == nil {
+		return fmt.Errorf("failed to open database")
+	}
+	return command(&Env{Config: conf, Log: log, DB: db}, args[1:])
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sushi/model"
+	"sushi/service"
+	"text/tabwriter"
+)
+
+const networkUsage = `usage: sushi network <command> [flags]
+
+commands:
+  list                         list the payment networks
+  create -chain-id N [flags]   validate and add a network
+  update -chain-id N [flags]   validate and change a network, only given flags are changed
+  validate -chain-id N         check the RPC, chain id, contract and ABI of a network
+  prices -chain-id N           list the accepted tokens of a network
+  set-price -chain-id N -token ADDRESS -min-amount N -duration SECONDS
+                               accept a token, min-amount buys duration seconds
+  delete-price -chain-id N -token ADDRESS
+                               stop accepting a token`
+
+// Network manages the payment networks the worker crawls.
+func Network(env *Env, args []string) error {
+	if len(args) == 0 {
+		return errors.New(networkUsage)
+	}
+	networks := service.NewNetworkService(env.DB, env.Log)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		return listNetworks(networks)
+	case "create":
+		var network model.Network
+		flags, abiFile := networkFlags("create", &network)
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if *abiFile != "" {
+			abi, err := os.ReadFile(*abiFile)
+			if err != nil {
+				return err
+			}
+			network.ABI = string(abi)
+		}
+		err = networks.CreateNetwork(ctx, &network)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("network %s (chain %d) created\n", network.Name, network.ChainID)
+		return nil
+	case "update":
+		var network model.Network
+		flags, abiFile := networkFlags("update", &network)
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		update := service.NetworkUpdate{}
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "contract":
+				update.ContractAddress = &network.ContractAddress
+			case "name":
+				update.Name = &network.Name
+			case "decimals":
+				update.Decimals = &network.Decimals
+			case "symbol":
+				update.Symbol = &network.Symbol
+			case "rpc-url":
+				update.RpcUrl = &network.RpcUrl
+			case "confirmations":
+				update.Confirmations = &network.Confirmations
+			case "block-time":
+				update.BlockTime = &network.BlockTime
+			case "start-block":
+				update.StartBlock = &network.StartBlock
+			case "nft-contract":
+				update.NFTContractAddress = &network.NFTContractAddress
+			}
+		})
+		if *abiFile != "" {
+			abi, err := os.ReadFile(*abiFile)
+			if err != nil {
+				return err
+			}
+			network.ABI = string(abi)
+			update.ABI = &network.ABI
+		}
+		updated, err := networks.UpdateNetwork(ctx, network.ChainID, update)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("network %s (chain %d) updated\n", updated.Name, updated.ChainID)
+		return nil
+	case "validate":
+		flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+		chainID := flags.Int64("chain-id", 0, "chain id of the network")
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		network, err := networks.GetNetwork(*chainID)
+		if err != nil {
+			return err
+		}
+		err = networks.ValidateNetwork(ctx, network)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("network %s (chain %d) is valid\n", network.Name, network.ChainID)
+		return nil
+	case "prices":
+		flags := flag.NewFlagSet("prices", flag.ContinueOnError)
+		chainID := flags.Int64("chain-id", 0, "chain id of the network")
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		return listPrices(networks, *chainID)
+	case "set-price":
+		var price model.Price
+		flags := flag.NewFlagSet("set-price", flag.ContinueOnError)
+		flags.Int64Var(&price.ChainID, "chain-id", 0, "chain id of the network")
+		flags.StringVar(&price.TokenAddress, "token", "", "accepted token address")
+		flags.StringVar(&price.MinAmount, "min-amount", "", "smallest accepted amount, in token units")
+		flags.Uint64Var(&price.Duration, "duration", 0, "seconds bought by min-amount")
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		err = networks.SetPrice(&price)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("price of %s on chain %d set\n", price.TokenAddress, price.ChainID)
+		return nil
+	case "delete-price":
+		flags := flag.NewFlagSet("delete-price", flag.ContinueOnError)
+		chainID := flags.Int64("chain-id", 0, "chain id of the network")
+		token := flags.String("token", "", "token address")
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		err = networks.DeletePrice(*chainID, *token)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("price of %s on chain %d deleted\n", *token, *chainID)
+		return nil
+	default:
+		return errors.New(networkUsage)
+	}
+}
+
+func listPrices(networks *service.NetworkService, chainID int64) error {
+	prices, err := networks.ListPrices(chainID)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOKEN\tMIN AMOUNT\tDURATION")
+	for _, price := range prices {
+		fmt.Fprintf(w, "%s\t%s\t%ds\n", price.TokenAddress, price.MinAmount, price.Duration)
+	}
+	return w.Flush()
+}
+
+func networkFlags(name string, network *model.Network) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Int64Var(&network.ChainID, "chain-id", 0, "chain id of the network")
+	flags.StringVar(&network.ContractAddress, "contract", "", "payment contract address")
+	flags.StringVar(&network.Name, "name", "", "network name")
+	flags.Int64Var(&network.Decimals, "decimals", 18, "decimals of the native token")
+	flags.StringVar(&network.Symbol, "symbol", "", "symbol of the native token")
+	flags.StringVar(&network.RpcUrl, "rpc-url", "", "websocket or http RPC URL")
+	flags.Uint64Var(&network.Confirmations, "confirmations", 0, "blocks before a payment is confirmed (0: worker default)")
+	flags.Uint64Var(&network.BlockTime, "block-time", 0, "average seconds per block (0: worker default)")
+	flags.Uint64Var(&network.StartBlock, "start-block", 0, "first block to crawl (0: sync_block_number)")
+	flags.StringVar(&network.NFTContractAddress, "nft-contract", "", "NFT contract whose tokens payments unlock (empty: nft_contract_address)")
+	abiFile := flags.String("abi-file", "", "file with the payment contract ABI JSON")
+	return flags, abiFile
+}
+
+func listNetworks(networks *service.NetworkService) error {
+	list, err := networks.ListNetworks()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAIN ID\tNAME\tCONTRACT\tRPC URL\tCONFIRMATIONS\tBLOCK TIME\tSTART BLOCK")
+	for _, network := range list {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\n", network.ChainID, network.Name, network.ContractAddress, network.RpcUrl, network.Confirmations, network.BlockTime, network.StartBlock)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sushi/utils"
+	"time"
+)
+
+const tokenUsage = `usage: sushi token -sub SUB [-mail MAIL] [-name NAME] [-roles ROLE,...] [-ttl DURATION]
+
+mints an ID token for the dev auth mode (auth_mode: dev), signed with dev_auth_key_file`
+
+// Token prints a token the API accepts in the dev auth mode, for any player.
+func Token(env *Env, args []string) error {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	sub := flags.String("sub", "", "sub of the player")
+	mail := flags.String("mail", "", "mail of the player")
+	name := flags.String("name", "", "name of the player")
+	roleList := flags.String("roles", "", "comma separated roles besides player, e.g. admin,finance")
+	ttl := flags.Duration("ttl", 24*time.Hour, "how long the token is valid")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *sub == "" {
+		return errors.New(tokenUsage)
+	}
+	var roles []string
+	for _, role := range strings.Split(*roleList, ",") {
+		if role == "" {
+			continue
+		}
+		if !utils.IsRole(role) {
+			return fmt.Errorf("unknown role %q", role)
+		}
+		roles = append(roles, role)
+	}
+	if env.Config.AuthMode() != "dev" {
+		env.Log.Warn("auth_mode is not dev, the API will reject this token")
+	}
+
+	key, err := utils.DevAuthKey(env.Config.DevAuthKeyFile())
+	if err != nil {
+		return err
+	}
+	token, err := utils.MintDevToken(key, *sub, *mail, *name, roles, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
@@ -0,0 +1,63 @@
+package controllor
+
+import (
+	"errors"
+	"strconv"
+	"sushi/utils"
+	"sushi/utils/custom_errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyJson struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+func (con *Controller) HandleListAPIKeys(c *gin.Context) {
+	apiKeys, err := con.service.APIKeys.ListAPIKeys()
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	utils.SuccessResponse(c, "", apiKeys)
+}
+
+func (con *Controller) HandleCreateAPIKey(c *gin.Context) {
+	var json APIKeyJson
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	key, apiKey, err := con.service.APIKeys.CreateAPIKey(json.Name, json.Scopes)
+	if err != nil {
+		handleAPIKeyError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", gin.H{"key": key, "api_key": apiKey})
+}
+
+func (con *Controller) HandleRevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, 401, "invalid api key id", "")
+		return
+	}
+	err = con.service.APIKeys.RevokeAPIKey(uint(id))
+	if err != nil {
+		handleAPIKeyError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", "")
+}
+
+func handleAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, custom_errors.API_KEY_NOT_FOUND_ERROR):
+		utils.ErrorResponse(c, 404, err.Error(), "")
+	case errors.Is(err, custom_errors.INVALID_API_KEY_SCOPE_ERROR):
+		utils.ErrorResponse(c, 400, err.Error(), "")
+	default:
+		utils.ErrorResponse(c, 501, err.Error(), "")
+	}
+}
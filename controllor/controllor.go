@@ -11,6 +11,7 @@ import (
 	"sushi/utils/config"
 	"sushi/utils/custom_errors"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -38,12 +39,17 @@ func (con *Controller) HandleNewPlayer(c *gin.Context) {
 		utils.ErrorResponse(c, 501, err.Error(), "")
 		return
 	}
-	err = con.service.NewPlayer(user.Mail, user.Sub)
+	var json service.Registration
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	player, err := con.service.NewPlayer(user.Mail, user.Sub, json)
 	if err != nil {
-		utils.ErrorResponse(c, 501, err.Error(), "")
+		handlePlayerError(c, err)
 		return
 	}
-	utils.SuccessResponse(c, "", "")
+	utils.SuccessResponse(c, "", player)
 }
 
 type UserTransJson struct {
@@ -152,6 +158,10 @@ func (con *Controller) HandleApplyWithdraw(c *gin.Context) {
 	}
 	err = con.service.ApplyWithdraw(userinfo.Sub, json.Amount)
 	if err != nil {
+		if errors.Is(err, custom_errors.WITHDRAW_ADDRESS_LOCKED_ERROR) {
+			utils.ErrorResponse(c, 403, err.Error(), "")
+			return
+		}
 		utils.ErrorResponse(c, 501, err.Error(), "")
 		return
 	}
@@ -340,9 +350,9 @@ func (con *Controller) HandleGetUserInfo(c *gin.Context) {
 		utils.ErrorResponse(c, 501, err.Error(), "")
 		return
 	}
-	player, err := con.service.GetUserInfo(userinfo.Mail, userinfo.Sub)
+	player, err := con.service.GetUserInfo(userinfo.Sub)
 	if err != nil {
-		utils.ErrorResponse(c, 501, err.Error(), "")
+		handlePlayerError(c, err)
 		return
 
 	}
@@ -379,18 +389,152 @@ func (con *Controller) HandleEditEthAddress(c *gin.Context) {
 		utils.ErrorResponse(c, 410, "eth address length must be 42", "")
 		return
 	}
+	if !common.IsHexAddress(json.EthAddress) {
+		utils.ErrorResponse(c, 410, "eth address must be hex", "")
+		return
+	}
 	err = con.service.EditEthAddress(userinfo.Sub, json.EthAddress)
 	if err != nil {
-		if errors.Is(err, custom_errors.ETH_ADDRESS_EXIST_ERROR) {
-			utils.ErrorResponse(c, 411, err.Error(), "")
-			return
-		}
+		handleEthAddressError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "ok", "")
+}
+
+func (con *Controller) HandleGetWalletNonce(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	nonce, err := con.service.NewWalletNonce(userinfo.Sub)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	utils.SuccessResponse(c, "", nonce)
+}
+
+type SiweJson struct {
+	Message   string `json:"message" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+}
+
+func (con *Controller) HandleVerifyEthAddress(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	var json SiweJson
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	wallet, err := con.service.VerifyEthAddress(userinfo.Sub, json.Message, json.Signature)
+	if err != nil {
+		handleEthAddressError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "ok", wallet)
+}
+
+func (con *Controller) HandleListWallets(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	wallets, err := con.service.ListWallets(userinfo.Sub)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	utils.SuccessResponse(c, "", wallets)
+}
+
+func (con *Controller) HandleGetWalletHistory(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	history, err := con.service.GetWalletHistory(userinfo.Sub)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	utils.SuccessResponse(c, "", history)
+}
+
+func (con *Controller) HandleAddWallet(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	var json EthAddress
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	if !common.IsHexAddress(json.EthAddress) {
+		utils.ErrorResponse(c, 410, "eth address must be hex", "")
+		return
+	}
+	wallet, err := con.service.AddWallet(userinfo.Sub, json.EthAddress)
+	if err != nil {
+		handleEthAddressError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "ok", wallet)
+}
+
+func (con *Controller) HandleRemoveWallet(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
 		utils.ErrorResponse(c, 501, err.Error(), "")
 		return
 	}
+	err = con.service.RemoveWallet(userinfo.Sub, c.Param("address"))
+	if err != nil {
+		handleEthAddressError(c, err)
+		return
+	}
 	utils.SuccessResponse(c, "ok", "")
 }
 
+func (con *Controller) HandleSetPrimaryWallet(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	err = con.service.SetPrimaryWallet(userinfo.Sub, c.Param("address"))
+	if err != nil {
+		handleEthAddressError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "ok", "")
+}
+
+func handleEthAddressError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, custom_errors.ETH_ADDRESS_EXIST_ERROR):
+		utils.ErrorResponse(c, 411, err.Error(), "")
+	case errors.Is(err, custom_errors.ETH_ADDRESS_NOT_PROVEN_ERROR):
+		utils.ErrorResponse(c, 403, err.Error(), "")
+	case errors.Is(err, custom_errors.WALLET_NOT_FOUND_ERROR):
+		utils.ErrorResponse(c, 404, err.Error(), "")
+	case errors.Is(err, custom_errors.WALLET_COOLDOWN_ERROR):
+		utils.ErrorResponse(c, 409, err.Error(), "")
+	case errors.Is(err, custom_errors.INVALID_SIWE_MESSAGE_ERROR), errors.Is(err, custom_errors.INVALID_NONCE_ERROR):
+		utils.ErrorResponse(c, 400, err.Error(), "")
+	default:
+		utils.ErrorResponse(c, 501, err.Error(), "")
+	}
+}
+
 func (con *Controller) HandleGetNfts(c *gin.Context) {
 	userinfo, err := getUserInfo(c)
 	if err != nil {
@@ -457,3 +601,85 @@ func (con *Controller) HandleGetFreebieRecords(c *gin.Context) {
 	}
 	utils.SuccessResponse(c, "", records)
 }
+
+func (con *Controller) HandleListIdentities(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	identities, err := con.service.ListIdentities(userinfo.Sub)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	utils.SuccessResponse(c, "", identities)
+}
+
+// HandleLinkIdentity links the identity authenticated by server.LinkIdentityAuth to the player.
+func (con *Controller) HandleLinkIdentity(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	identity, ok := c.MustGet("link_identity").(*service.Identity)
+	if !ok {
+		utils.ErrorResponse(c, 501, custom_errors.GET_USERINFO_ERROR.Error(), "")
+		return
+	}
+	err = con.service.LinkIdentity(userinfo.Sub, identity)
+	if err != nil {
+		if errors.Is(err, custom_errors.IDENTITY_EXIST_ERROR) {
+			utils.ErrorResponse(c, 409, err.Error(), "")
+			return
+		}
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	utils.SuccessResponse(c, "ok", "")
+}
+
+func (con *Controller) HandleExportPlayer(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	export, err := con.service.ExportPlayer(userinfo.Sub)
+	if err != nil {
+		handlePlayerError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=sushi-export.json")
+	utils.SuccessResponse(c, "", export)
+}
+
+// HandleDeletePlayer deletes the signed in player, and their Firebase login with
+// ?delete_login=true.
+func (con *Controller) HandleDeletePlayer(c *gin.Context) {
+	userinfo, err := getUserInfo(c)
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	err = con.service.DeletePlayer(c.Request.Context(), userinfo.Sub, c.Query("delete_login") == "true")
+	if err != nil {
+		handlePlayerError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", "")
+}
+
+func handlePlayerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, custom_errors.PLAYER_NOT_EXIST_ERROR):
+		utils.ErrorResponse(c, 404, err.Error(), "")
+	case errors.Is(err, custom_errors.PLAYER_EXIST_ERROR), errors.Is(err, custom_errors.WITHDRAW_PENDING_ERROR):
+		utils.ErrorResponse(c, 409, err.Error(), "")
+	case errors.Is(err, custom_errors.TERMS_NOT_ACCEPTED_ERROR):
+		utils.ErrorResponse(c, 400, err.Error(), "")
+	default:
+		utils.ErrorResponse(c, 501, err.Error(), "")
+	}
+}
@@ -0,0 +1,160 @@
+package controllor
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"sushi/model"
+	"sushi/service"
+	"sushi/utils"
+	"sushi/utils/custom_errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (con *Controller) HandleListNetworks(c *gin.Context) {
+	networks, err := con.service.Networks.ListNetworks()
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	// RPC URLs usually embed a provider API key, only those who can change them see them
+	if !utils.HasPermission(c.GetStringSlice("permissions"), utils.PERMISSION_NETWORKS_WRITE) {
+		for i := range networks {
+			networks[i].RpcUrl = redactURL(networks[i].RpcUrl)
+		}
+	}
+	utils.SuccessResponse(c, "", networks)
+}
+
+// redactURL keeps the scheme and host of a URL, enough to tell providers apart.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/..."
+}
+
+func (con *Controller) HandleCreateNetwork(c *gin.Context) {
+	var json model.Network
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	err := con.service.Networks.CreateNetwork(c.Request.Context(), &json)
+	if err != nil {
+		handleNetworkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", json)
+}
+
+func (con *Controller) HandleUpdateNetwork(c *gin.Context) {
+	chainID, err := strconv.ParseInt(c.Param("chain_id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, 401, "invalid chain id", "")
+		return
+	}
+	var json service.NetworkUpdate
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	network, err := con.service.Networks.UpdateNetwork(c.Request.Context(), chainID, json)
+	if err != nil {
+		handleNetworkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", network)
+}
+
+func (con *Controller) HandleValidateNetwork(c *gin.Context) {
+	chainID, err := strconv.ParseInt(c.Param("chain_id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, 401, "invalid chain id", "")
+		return
+	}
+	network, err := con.service.Networks.GetNetwork(chainID)
+	if err != nil {
+		handleNetworkError(c, err)
+		return
+	}
+	err = con.service.Networks.ValidateNetwork(c.Request.Context(), network)
+	if err != nil {
+		handleNetworkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "ok", "")
+}
+
+type PriceJson struct {
+	MinAmount string `json:"min_amount"` // decimal string, token amounts exceed JSON numbers
+	Duration  uint64 `json:"duration"`
+}
+
+func (con *Controller) HandleListPrices(c *gin.Context) {
+	chainID, err := strconv.ParseInt(c.Param("chain_id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, 401, "invalid chain id", "")
+		return
+	}
+	prices, err := con.service.Networks.ListPrices(chainID)
+	if err != nil {
+		handleNetworkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", prices)
+}
+
+func (con *Controller) HandleSetPrice(c *gin.Context) {
+	chainID, err := strconv.ParseInt(c.Param("chain_id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, 401, "invalid chain id", "")
+		return
+	}
+	var json PriceJson
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	price := model.Price{
+		ChainID:      chainID,
+		TokenAddress: c.Param("token_address"),
+		MinAmount:    json.MinAmount,
+		Duration:     json.Duration,
+	}
+	err = con.service.Networks.SetPrice(&price)
+	if err != nil {
+		handleNetworkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", price)
+}
+
+func (con *Controller) HandleDeletePrice(c *gin.Context) {
+	chainID, err := strconv.ParseInt(c.Param("chain_id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, 401, "invalid chain id", "")
+		return
+	}
+	err = con.service.Networks.DeletePrice(chainID, c.Param("token_address"))
+	if err != nil {
+		handleNetworkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", "")
+}
+
+func handleNetworkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, custom_errors.NETWORK_NOT_FOUND_ERROR), errors.Is(err, custom_errors.PRICE_NOT_FOUND_ERROR):
+		utils.ErrorResponse(c, 404, err.Error(), "")
+	case errors.Is(err, custom_errors.NETWORK_EXIST_ERROR):
+		utils.ErrorResponse(c, 409, err.Error(), "")
+	case errors.Is(err, custom_errors.INVALID_NETWORK_ERROR), errors.Is(err, custom_errors.INVALID_PRICE_ERROR):
+		utils.ErrorResponse(c, 400, err.Error(), "")
+	default:
+		utils.ErrorResponse(c, 501, err.Error(), "")
+	}
+}
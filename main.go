@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"sushi/cli"
 	"sushi/server"
 	"sushi/worker"
 )
@@ -13,6 +14,11 @@ func main() {
 	argsLen := len(args)
 	if argsLen > 0 && args[0] == "worker" {
 		log.Fatal(worker.Start())
+	} else if argsLen > 0 && cli.IsCommand(args[0]) {
+		err := cli.Run(args)
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else {
 		log.Fatal(server.Start())
 	}
@@ -14,6 +14,18 @@ type Player struct {
 	Sub       string    `gorm:"index" json:"sub"`
 	CreatedAt time.Time `json:"created_at"`
 	LoginAt   time.Time `json:"login_at"`
+	// set when the player deleted their account, the row is kept for the ledger
+	AnonymisedAt *time.Time `json:"-"`
+}
+
+// Signup records how a player registered, one row per player.
+type Signup struct {
+	UserID        uint      `gorm:"primaryKey" json:"-"`
+	Region        uint      `json:"region"`
+	ReferralCode  string    `gorm:"size:32;index" json:"referral_code"`
+	ClientVersion string    `gorm:"size:32" json:"client_version"`
+	TermsVersion  string    `gorm:"size:32" json:"terms_version"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 //type Balance struct {
@@ -84,6 +96,12 @@ type Contract struct {
 	TokenType           string `json:"tokenType"`
 	ContractDeployer    string `json:"contractDeployer"`
 	DeployedBlockNumber uint64 `json:"deployedBlockNumber"`
+	// tracked contracts are crawled by the worker
+	Tracked   bool   `gorm:"index" json:"-"`
+	Chain     string `json:"chain"`
+	ChainID   int64  `json:"-"`
+	RpcUrl    string `json:"-"`
+	FromBlock uint64 `json:"-"`
 }
 
 type Collection struct {
@@ -107,6 +125,7 @@ type NFT struct {
 }
 
 type NFTImage struct {
+	ContractID   uint64 `gorm:"index" json:"-"`
 	TokenId      string `gorm:"index" json:"-"`
 	TokenType    string `json:"-"`
 	CachedUrl    string `json:"cachedUrl"`
@@ -118,17 +137,28 @@ type NFTImage struct {
 }
 
 type Owner struct {
-	Address   string `json:"address"`
-	TokenType string `json:"-"`
-	TokenId   string `json:"tokenId"`
-	Balance   string `json:"balance"`
+	ContractID uint64 `gorm:"index" json:"-"`
+	Address    string `json:"address"`
+	TokenType  string `json:"-"`
+	TokenId    string `json:"tokenId"`
+	Balance    string `json:"balance"`
+	Generation uint64 `gorm:"index" json:"-"`
+}
+
+// OwnerGeneration points at the owner snapshot of a contract readers should use. A full crawl
+// writes the next generation and only switches Active once it completed.
+type OwnerGeneration struct {
+	ContractID uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Active     uint64
+	Block      uint64 // block the active snapshot was taken at, 0 if unknown
 }
 
 type Attributes struct {
-	TokenId   string `json:"-"`
-	TokenType string `json:"-"`
-	Type      string `json:"Type"`
-	Rarity    string `json:"Rarity"`
+	ContractID uint64 `gorm:"index" json:"-"`
+	TokenId    string `json:"-"`
+	TokenType  string `json:"-"`
+	Type       string `json:"Type"`
+	Rarity     string `json:"Rarity"`
 }
 
 func GetNameFromBlobID(id uint64) string {
@@ -171,14 +201,20 @@ type LatestBlock struct {
 	LatestBlockNumber uint64
 }
 
+// Network is a chain the worker crawls payments on, one crawler per row.
 type Network struct {
-	ChainID         int64
-	ContractAddress string `gorm:"unique"`
-	Name            string
-	Decimals        int64
-	Symbol          string
-	RpcUrl          string
-	ABI             string
+	ChainID         int64  `json:"chain_id"`
+	ContractAddress string `gorm:"unique" json:"contract_address"`
+	Name            string `json:"name"`
+	Decimals        int64  `json:"decimals"`
+	Symbol          string `json:"symbol"`
+	RpcUrl          string `json:"rpc_url"`
+	ABI             string `json:"abi"`
+	Confirmations   uint64 `json:"confirmations"` // blocks before a payment is confirmed, 0 for the worker default
+	BlockTime       uint64 `json:"block_time"`    // average seconds per block, 0 for the worker default
+	StartBlock      uint64 `json:"start_block"`   // first block crawled, 0 for sync_block_number
+	// NFT contract whose tokens payments unlock, nft_contract_address when empty
+	NFTContractAddress string `json:"nft_contract_address"`
 }
 
 type ConfirmStatus string
@@ -189,15 +225,129 @@ const (
 )
 
 type RechargeNFT struct {
-	Payer        string
-	Received     string
-	TokenAddress string
-	TokenID      string
-	ExpiryDate   uint64
-	Amount       uint64
-	Status       ConfirmStatus
+	TxHash          string `gorm:"index:idx_recharge_log"`
+	LogIndex        uint   `gorm:"index:idx_recharge_log"`
+	Payer           string
+	Received        string
+	TokenAddress    string
+	ChainID         int64  // chain of the NFT contract
+	ContractAddress string `gorm:"size:42"` // NFT contract the payment unlocks TokenID of
+	TokenID         string
+	StartDate       uint64 // start of the period this payment bought, 0 before subscriptions
+	ExpiryDate      uint64
+	Amount          string `gorm:"size:78"` // decimal string of the uint256 paid
+	Refunded        string `gorm:"size:78"` // decimal string of the uint256 refunded so far
+	Duration        uint64 // seconds credited, 0 before pricing
+	RejectReason    string // why the payment was recorded but not credited
+	Status          ConfirmStatus
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Identity maps an account of an identity provider onto a player. A player can sign in with
+// several identities.
+type Identity struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"index" json:"-"`
+	Issuer    string    `gorm:"size:191;uniqueIndex:idx_identity" json:"issuer"`
+	Subject   string    `gorm:"size:191;uniqueIndex:idx_identity" json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey authenticates a machine client like the game server. Only the SHA-256 of the key is
+// stored; Prefix tells keys apart.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"size:64" json:"name"`
+	Prefix     string     `gorm:"size:16" json:"prefix"`
+	Hash       string     `gorm:"size:64;uniqueIndex" json:"-"`
+	Scopes     string     `json:"scopes"` // comma separated
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// PlayerWallet is an address linked to a player. An address belongs to one player at most; the
+// primary wallet is mirrored in Player.EthAddress.
+type PlayerWallet struct {
+	ID         uint       `gorm:"primaryKey" json:"-"`
+	UserID     uint       `gorm:"index" json:"-"`
+	Address    string     `gorm:"size:42;uniqueIndex" json:"address"`
+	ChainID    int64      `json:"chain_id"`
+	VerifiedAt *time.Time `json:"verified_at"` // nil for addresses linked before proofs
+	IsPrimary  bool       `json:"primary"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type WalletAction string
+
+const (
+	WalletLinked   WalletAction = "linked"
+	WalletUnlinked WalletAction = "unlinked"
+	WalletPrimary  WalletAction = "primary"
+)
+
+// WalletHistory records every change to the wallets of a player.
+type WalletHistory struct {
+	ID        uint         `gorm:"primaryKey" json:"-"`
+	UserID    uint         `gorm:"index" json:"-"`
+	Address   string       `gorm:"size:42;index" json:"address"`
+	Action    WalletAction `gorm:"size:16" json:"action"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// WalletNonce is a Sign-In With Ethereum nonce issued to a player, usable once before ExpiryDate.
+type WalletNonce struct {
+	Nonce      string `gorm:"size:32;primaryKey"`
+	UserID     uint   `gorm:"index"`
+	ExpiryDate uint64
+	CreatedAt  time.Time
+}
+
+// WalletProof records that a player signed a Sign-In With Ethereum message with an address.
+// Only proven addresses can be linked to the player.
+type WalletProof struct {
+	UserID    uint   `gorm:"uniqueIndex:idx_wallet_proof"`
+	Address   string `gorm:"size:42;uniqueIndex:idx_wallet_proof"`
+	ChainID   int64
+	CreatedAt time.Time
+}
+
+// Subscription is how long a payer has access to a token of an NFT contract. Every credited
+// payment extends it from the later of its block time and the current expiry; recharge_nfts
+// keeps the history.
+type Subscription struct {
+	Payer           string    `gorm:"size:42;uniqueIndex:idx_subscription_nft" json:"payer"`
+	ChainID         int64     `json:"chainId"` // chain of the NFT contract
+	ContractAddress string    `gorm:"size:42;uniqueIndex:idx_subscription_nft" json:"contractAddress"`
+	TokenID         string    `gorm:"size:78;uniqueIndex:idx_subscription_nft" json:"tokenId"`
+	ExpiryDate      uint64    `json:"expiryDate"`
+	CreatedAt       time.Time `json:"-"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// Price is what a payment in a token buys on a network: MinAmount buys Duration seconds and
+// larger amounts buy proportionally more. Payments below MinAmount or in tokens without a price
+// are not credited.
+type Price struct {
+	ChainID      int64     `gorm:"uniqueIndex:idx_price" json:"chain_id"`
+	TokenAddress string    `gorm:"size:42;uniqueIndex:idx_price" json:"token_address"`
+	MinAmount    string    `gorm:"size:78" json:"min_amount"` // decimal string, a uint256 in token units
+	Duration     uint64    `json:"duration"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ContractEvent is a payment contract log that was applied, so a resync does not apply it twice.
+type ContractEvent struct {
+	ChainID     int64  `gorm:"uniqueIndex:idx_contract_event"`
+	TxHash      string `gorm:"size:66;uniqueIndex:idx_contract_event"`
+	LogIndex    uint   `gorm:"uniqueIndex:idx_contract_event"`
+	Name        string
+	BlockNumber uint64
+	// why a log the contract emitted could not be applied, e.g. a value out of range
+	RejectReason string
 	CreatedAt    time.Time
-	UpdatedAt    time.Time
 }
 
 type FreebieEarnTotal struct {
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sushi/service"
+	"sushi/utils"
+	"sushi/utils/custom_errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticator turns the bearer tokens of one issuer into identities.
+type Authenticator interface {
+	Issuer() string
+	Authenticate(ctx context.Context, token string) (*service.Identity, error)
+}
+
+type firebaseAuthenticator struct {
+	verifier *utils.FirebaseVerifier
+}
+
+func (auth *firebaseAuthenticator) Issuer() string {
+	return auth.verifier.Issuer()
+}
+
+func (auth *firebaseAuthenticator) Authenticate(ctx context.Context, token string) (*service.Identity, error) {
+	claims, err := auth.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &service.Identity{
+		Issuer:  auth.Issuer(),
+		Subject: claims.Sub,
+		Email:   claims.Email,
+		Name:    claims.Name,
+		Sub:     claims.Sub,
+		Roles:   filterRoles(claims.Roles),
+	}, nil
+}
+
+// oidcAuthenticator accepts the ID tokens of an OpenID Connect issuer. Players created for its
+// accounts get "<name>:<subject>" as sub. The issuer isn't ours, so its roles claim is ignored and
+// its accounts are players only.
+type oidcAuthenticator struct {
+	name     string
+	verifier *utils.OIDCVerifier
+}
+
+func (auth *oidcAuthenticator) Issuer() string {
+	return auth.verifier.Issuer()
+}
+
+func (auth *oidcAuthenticator) Authenticate(ctx context.Context, token string) (*service.Identity, error) {
+	claims, err := auth.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &service.Identity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+		Name:    claims.Name,
+		Sub:     auth.name + ":" + claims.Subject,
+	}, nil
+}
+
+// devAuthenticator accepts the tokens minted by `sushi token` in the dev auth mode. Their sub is
+// used as is, like a Firebase uid.
+type devAuthenticator struct {
+	verifier *utils.OIDCVerifier
+}
+
+func (auth *devAuthenticator) Issuer() string {
+	return auth.verifier.Issuer()
+}
+
+func (auth *devAuthenticator) Authenticate(ctx context.Context, token string) (*service.Identity, error) {
+	claims, err := auth.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &service.Identity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+		Name:    claims.Name,
+		Sub:     claims.Subject,
+		Roles:   claims.Roles,
+	}, nil
+}
+
+// filterRoles drops the roles that aren't known.
+func filterRoles(roles []string) []string {
+	var known []string
+	for _, role := range roles {
+		if utils.IsRole(role) {
+			known = append(known, role)
+		}
+	}
+	return known
+}
+
+// newAuthenticators sets up Firebase, or the dev key pair in the dev auth mode, and the
+// configured OpenID Connect providers, by issuer.
+func (server *Server) newAuthenticators(ctx context.Context) map[string]Authenticator {
+	authenticators := make(map[string]Authenticator)
+	add := func(auth Authenticator) {
+		if _, ok := authenticators[auth.Issuer()]; ok {
+			server.log.Error("duplicate authenticator for issuer ", auth.Issuer())
+			return
+		}
+		authenticators[auth.Issuer()] = auth
+	}
+
+	if server.config.AuthMode() == "dev" {
+		key, err := utils.DevAuthKey(server.config.DevAuthKeyFile())
+		if err != nil {
+			server.log.Error("failed to load dev auth key: ", err)
+		} else {
+			server.log.Warn("dev auth mode: accepting tokens signed by ", server.config.DevAuthKeyFile())
+			verifier := utils.NewOIDCVerifier(utils.DEV_AUTH_ISSUER, utils.DEV_AUTH_AUDIENCE, utils.DevAuthKeySource(key), server.log)
+			add(&devAuthenticator{verifier: verifier})
+		}
+	}
+	if server.service.Firebase.Verifier != nil {
+		add(&firebaseAuthenticator{verifier: server.service.Firebase.Verifier})
+	}
+	for _, provider := range server.config.OIDCProviders() {
+		if provider.Name == "" || provider.Issuer == "" || provider.Audience == "" {
+			server.log.Error("oidc provider needs a name, issuer and audience: ", provider)
+			continue
+		}
+		verifier := utils.NewOIDCVerifier(provider.Issuer, provider.Audience, utils.NewJWKSKeySource(provider.Issuer, provider.JWKSURL), server.log)
+		go verifier.Run(ctx)
+		add(&oidcAuthenticator{name: provider.Name, verifier: verifier})
+	}
+	return authenticators
+}
+
+// authenticate verifies token with the authenticator of its issuer.
+func (server *Server) authenticate(ctx context.Context, token string) (*service.Identity, error) {
+	issuer, err := utils.TokenIssuer(token)
+	if err != nil {
+		return nil, err
+	}
+	auth, ok := server.authenticators[issuer]
+	if !ok {
+		return nil, fmt.Errorf("unknown issuer %q", issuer)
+	}
+	return auth.Authenticate(ctx, token)
+}
+
+type LinkIdentityJson struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// LinkIdentityAuth authenticates the token of another identity provider posted to link it to
+// the signed in player.
+func (server *Server) LinkIdentityAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var json LinkIdentityJson
+		if err := c.ShouldBindJSON(&json); err != nil {
+			utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+			return
+		}
+		identity, err := server.authenticate(c.Request.Context(), json.Token)
+		if err != nil {
+			utils.ErrorResponse(c, 400, err.Error(), "")
+			return
+		}
+		c.Set("link_identity", identity)
+	}
+}
@@ -6,11 +6,19 @@ import (
 	"sushi/service"
 )
 
+// closerFunc closes by calling a function, e.g. the cancel of the service context.
+type closerFunc func()
+
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
+
 func (server *Server) NewService() []io.Closer {
-	ctx, _ := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
 	svc := service.NewService(server.db, server.log, server.config, ctx)
 	// add all services that need to be closed
-	toClose := []io.Closer{}
+	toClose := []io.Closer{closerFunc(cancel)}
 	server.service = svc
 	return toClose
 }
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"sushi/utils"
+	"sushi/utils/custom_errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission lets the request through when the roles of its token, or the scopes of its
+// API key, grant permission.
+func (server *Server) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.HasPermission(c.GetStringSlice("permissions"), permission) {
+			utils.ErrorResponse(c, 403, custom_errors.PERMISSION_DENIED_ERROR.Error(), "")
+			return
+		}
+		c.Next()
+	}
+}
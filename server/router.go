@@ -23,11 +23,9 @@ func NewRouter(server *Server, conf config.Config, socketserver *socketio.Server
 	r.GET("/ping", server.controller.HandlePing)
 	r.POST("/users/exist", server.controller.HandleGetUserExist)
 
-	//from game server(RSA 签名)
+	//from game server: POST /service/earn, see WithServiceRoutes
 	// API v1
 	// r.POST("/earn", server.controller.HandleEarn)
-	// API v2: support freebie
-	r.POST("/earn", server.controller.HandleEarnAllowFreebie)
 
 	//from player
 
@@ -45,7 +43,7 @@ func NewRouter(server *Server, conf config.Config, socketserver *socketio.Server
 
 	v1 := r.Group("/v1")
 	authorizedV1 := v1.Group("/")
-	authorizedV1.Use(server.GetAuth())
+	authorizedV1.Use(server.GetAuth(), server.RequirePermission(utils.PERMISSION_PLAY))
 	//
 	//v1Team := v1.Group("/teams")
 	//v1Team.Use(server.GetAuth())
@@ -63,9 +61,46 @@ func NewRouter(server *Server, conf config.Config, socketserver *socketio.Server
 	//
 	//
 	//WithTeamRoutes(v1Team, server)
+
+	admin := r.Group("/admin")
+	admin.Use(server.GetServiceAuth())
+	WithAdminRoutes(admin, server)
+
+	//from game server and tx server
+	internal := r.Group("/service")
+	internal.Use(server.GetServiceAuth())
+	WithServiceRoutes(internal, server)
 	return r
 }
 
+func WithAdminRoutes(r *gin.RouterGroup, server *Server) {
+	read := r.Group("/", server.RequirePermission(utils.PERMISSION_NETWORKS_READ))
+	read.GET("/networks", server.controller.HandleListNetworks)
+	read.GET("/networks/:chain_id/prices", server.controller.HandleListPrices)
+
+	networks := r.Group("/", server.RequirePermission(utils.PERMISSION_NETWORKS_WRITE))
+	networks.POST("/networks", server.controller.HandleCreateNetwork)
+	networks.PATCH("/networks/:chain_id", server.controller.HandleUpdateNetwork)
+	networks.POST("/networks/:chain_id/validate", server.controller.HandleValidateNetwork)
+
+	prices := r.Group("/", server.RequirePermission(utils.PERMISSION_PRICES_WRITE))
+	prices.PUT("/networks/:chain_id/prices/:token_address", server.controller.HandleSetPrice)
+	prices.DELETE("/networks/:chain_id/prices/:token_address", server.controller.HandleDeletePrice)
+
+	apiKeys := r.Group("/", server.RequirePermission(utils.PERMISSION_API_KEYS))
+	apiKeys.GET("/api-keys", server.controller.HandleListAPIKeys)
+	apiKeys.POST("/api-keys", server.controller.HandleCreateAPIKey)
+	apiKeys.DELETE("/api-keys/:id", server.controller.HandleRevokeAPIKey)
+}
+
+func WithServiceRoutes(r *gin.RouterGroup, server *Server) {
+	r.POST("/earn", server.RequirePermission(utils.PERMISSION_EARN), server.controller.HandleEarnAllowFreebie)
+
+	withdraw := r.Group("/", server.RequirePermission(utils.PERMISSION_WITHDRAW))
+	withdraw.POST("/withdraw", server.controller.HandleHandleWithdraw)
+	withdraw.PATCH("/withdraw", server.controller.HandleConfirmWithdraw)
+}
+
 func WithTeamRoutes(r *gin.RouterGroup, server *Server) {
 	//r.GET("/", server.controller.team.HandleTeamList)
 }
@@ -84,6 +119,17 @@ func WithUserRoutes(r *gin.RouterGroup, server *Server, conf config.Config) {
 	authorized.GET("/earn_total", server.controller.HandleGetEarnTotal)
 	authorized.GET("/withdraw_total", server.controller.HandleGetWithdrawTotal)
 	authorized.POST("/ethaddr", server.controller.HandleEditEthAddress)
+	authorized.GET("/ethaddr/nonce", server.controller.HandleGetWalletNonce)
+	authorized.POST("/ethaddr/verify", server.controller.HandleVerifyEthAddress)
+	authorized.GET("/wallets", server.controller.HandleListWallets)
+	authorized.GET("/wallets/history", server.controller.HandleGetWalletHistory)
+	authorized.POST("/wallets", server.controller.HandleAddWallet)
+	authorized.DELETE("/wallets/:address", server.controller.HandleRemoveWallet)
+	authorized.POST("/wallets/:address/primary", server.controller.HandleSetPrimaryWallet)
+	authorized.GET("/identities", server.controller.HandleListIdentities)
+	authorized.POST("/identities", server.LinkIdentityAuth(), server.controller.HandleLinkIdentity)
+	authorized.GET("/me/export", server.controller.HandleExportPlayer)
+	authorized.DELETE("/me", server.controller.HandleDeletePlayer)
 	authorized.GET("/nfts", server.controller.HandleGetNfts)
 	authorized.GET("/freebie_record", server.controller.HandleGetFreebieRecords)
 	//authorized.POST("/users/profile", server.controller.user.HandleUpdateUserInfo)
@@ -103,22 +149,48 @@ func (server Server) GetAuth() gin.HandlerFunc {
 			return
 		}
 
-		err := utils.VerifyFirebaseJWT(server.service.Firebase, *server.service.Ctx, parts[1])
-		if err != nil {
-			utils.ErrorResponse(c, 400, "wrong project", "")
+		if len(parts) != 2 {
+			utils.ErrorResponse(c, 400, "token not valid", "")
 			return
 		}
-
-		detail, err := utils.CheckFirebaseJWT(parts[1])
+		identity, err := server.authenticate(c.Request.Context(), parts[1])
 		if err != nil {
 			utils.ErrorResponse(c, 400, err.Error(), "")
 			return
 		}
+		sub, err := server.service.ResolveIdentity(identity)
+		if err != nil {
+			utils.ErrorResponse(c, 501, err.Error(), "")
+			return
+		}
+
+		c.Set("sub", sub)
+		c.Set("name", identity.Name)
+		c.Set("mail", identity.Email)
+		roles := append([]string{utils.ROLE_PLAYER}, identity.Roles...)
+		c.Set("roles", roles)
+		c.Set("permissions", utils.RolePermissions(roles))
+	}
+}
 
-		firebaseSub := detail.Sub
-		c.Set("sub", firebaseSub)
-		c.Set("name", detail.Name)
-		c.Set("mail", detail.Email)
+// GetServiceAuth authenticates machine clients by the API key in X-API-Key, and accounts by
+// their token like GetAuth.
+func (server Server) GetServiceAuth() gin.HandlerFunc {
+	auth := server.GetAuth()
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			auth(c)
+			return
+		}
+		apiKey, err := server.service.APIKeys.Authenticate(key)
+		if err != nil {
+			utils.ErrorResponse(c, 401, err.Error(), "")
+			return
+		}
+		c.Set("sub", "")
+		c.Set("api_key", apiKey.ID)
+		c.Set("permissions", utils.ScopePermissions(strings.Split(apiKey.Scopes, ",")))
 	}
 }
 
@@ -126,8 +198,8 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Auth-Token, Authorization, Code, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT , PATCH")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Auth-Token, Authorization, Code, accept, origin, Cache-Control, X-Requested-With, X-API-Key")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT , PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -137,11 +209,3 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-func adminAuth() gin.HandlerFunc {
-	accounts := gin.Accounts{
-		"larry":     "larrykey",
-		"scheduler": "schedulerkey",
-	}
-	return gin.BasicAuth(accounts)
-}
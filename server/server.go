@@ -20,6 +20,8 @@ type Server struct {
 	controller *controllor.Controller
 	service    *service.Service
 	db         *DB.DB
+
+	authenticators map[string]Authenticator // by issuer
 }
 
 func CreateServer() *http.Server {
@@ -44,6 +46,10 @@ func CreateServer() *http.Server {
 		log.Formatter = &logrus.JSONFormatter{}
 	}
 
+	if conf.AuthMode() == "dev" && conf.GinMode() == "release" {
+		log.Fatal("auth_mode dev is not allowed with gin_mode release")
+	}
+
 	/*
 		Initialize Server
 	*/
@@ -58,6 +64,7 @@ func CreateServer() *http.Server {
 		Initialize Services
 	*/
 	closers := svr.NewService()
+	svr.authenticators = svr.newAuthenticators(*svr.service.Ctx)
 
 	/*
 		Initialize Controllers
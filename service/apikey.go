@@ -0,0 +1,114 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sushi/model"
+	"sushi/utils"
+	"sushi/utils/DB"
+	"sushi/utils/custom_errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	API_KEY_PREFIX     = "sk_"
+	API_KEY_BYTES      = 32
+	API_KEY_PREFIX_LEN = 12 // characters of a key kept in APIKey.Prefix
+	// last_used_at is written at most this often per key
+	API_KEY_LAST_USED_INTERVAL = time.Minute
+)
+
+// APIKeyService manages the API keys of machine clients. Like NetworkService it only needs the
+// database so the CLI can use it.
+type APIKeyService struct {
+	db  *DB.DB
+	log *logrus.Logger
+}
+
+func NewAPIKeyService(db *DB.DB, log *logrus.Logger) *APIKeyService {
+	return &APIKeyService{db: db, log: log}
+}
+
+// CreateAPIKey stores a new key with scopes and returns it. The key itself is not stored and
+// can't be shown again.
+func (svc *APIKeyService) CreateAPIKey(name string, scopes []string) (string, *model.APIKey, error) {
+	if name == "" || len(scopes) == 0 {
+		return "", nil, custom_errors.INVALID_API_KEY_SCOPE_ERROR
+	}
+	for _, scope := range scopes {
+		if !utils.IsScope(scope) {
+			return "", nil, custom_errors.INVALID_API_KEY_SCOPE_ERROR
+		}
+	}
+
+	secret := make([]byte, API_KEY_BYTES)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	key := API_KEY_PREFIX + hex.EncodeToString(secret)
+	apiKey := model.APIKey{
+		Name:   name,
+		Prefix: key[:API_KEY_PREFIX_LEN],
+		Hash:   hashAPIKey(key),
+		Scopes: strings.Join(scopes, ","),
+	}
+	err = svc.db.DB.Create(&apiKey).Error
+	if err != nil {
+		return "", nil, err
+	}
+	svc.log.Info("api key ", apiKey.ID, " (", name, ") created with scopes ", apiKey.Scopes)
+	return key, &apiKey, nil
+}
+
+func (svc *APIKeyService) ListAPIKeys() ([]model.APIKey, error) {
+	var apiKeys []model.APIKey
+	err := svc.db.DB.Order("id").Find(&apiKeys).Error
+	return apiKeys, err
+}
+
+// RevokeAPIKey stops a key from authenticating. The row is kept for its history.
+func (svc *APIKeyService) RevokeAPIKey(id uint) error {
+	result := svc.db.DB.Model(&model.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return custom_errors.API_KEY_NOT_FOUND_ERROR
+	}
+	svc.log.Info("api key ", id, " revoked")
+	return nil
+}
+
+// Authenticate returns the unrevoked key matching key and records that it was used.
+func (svc *APIKeyService) Authenticate(key string) (*model.APIKey, error) {
+	var apiKey model.APIKey
+	result := svc.db.DB.Where("hash = ? AND revoked_at IS NULL", hashAPIKey(key)).Limit(1).Find(&apiKey)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, custom_errors.INVALID_API_KEY_ERROR
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > API_KEY_LAST_USED_INTERVAL {
+		err := svc.db.DB.Model(&apiKey).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			svc.log.Error("failed to record use of api key ", apiKey.ID, ": ", err)
+		}
+		apiKey.LastUsedAt = &now
+	}
+	return &apiKey, nil
+}
+
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
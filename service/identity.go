@@ -0,0 +1,118 @@
+package service
+
+import (
+	"strings"
+	"sushi/model"
+	"sushi/utils/custom_errors"
+)
+
+// Identity is an account of an identity provider, as authenticated from a token.
+type Identity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+	// Sub keys the player created for the identity. Firebase identities keep the Firebase uid
+	// players were always keyed on.
+	Sub string
+	// Roles granted by the identity provider, besides player
+	Roles []string
+}
+
+// ResolveIdentity returns the sub of the player signed in with identity. An identity without a
+// player yet resolves to identity.Sub, which NewPlayer then creates the player with; the
+// identity is recorded on its first request after that.
+func (svc *Service) ResolveIdentity(identity *Identity) (string, error) {
+	var row model.Identity
+	result := svc.db.DB.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Limit(1).Find(&row)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected > 0 {
+		var player model.Player
+		err := svc.db.DB.Where("user_id = ?", row.UserID).First(&player).Error
+		if err != nil {
+			return "", err
+		}
+		return player.Sub, nil
+	}
+
+	var player model.Player
+	result = svc.db.DB.Where("sub = ?", identity.Sub).Limit(1).Find(&player)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return identity.Sub, nil
+	}
+	err := svc.db.DB.Create(&model.Identity{
+		UserID:  player.UserId,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	}).Error
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "Error 1062 (23000): Duplicate entry") {
+			// recorded by a concurrent request
+			return player.Sub, nil
+		}
+		return "", err
+	}
+	svc.log.Info("identity ", identity.Issuer, " ", identity.Subject, " recorded for player ", player.UserId)
+	return player.Sub, nil
+}
+
+func (svc *Service) ListIdentities(sub string) ([]model.Identity, error) {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return nil, err
+	}
+	identities := make([]model.Identity, 0)
+	err = svc.db.DB.Where("user_id = ?", player.UserId).Order("id").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// LinkIdentity lets the player of sub also sign in with identity.
+func (svc *Service) LinkIdentity(sub string, identity *Identity) error {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return err
+	}
+	var row model.Identity
+	result := svc.db.DB.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Limit(1).Find(&row)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		if row.UserID != player.UserId {
+			return custom_errors.IDENTITY_EXIST_ERROR
+		}
+		return nil
+	}
+	// the identity may already have a player of its own
+	var count int64
+	err = svc.db.DB.Model(&model.Player{}).Where("sub = ? AND user_id <> ?", identity.Sub, player.UserId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return custom_errors.IDENTITY_EXIST_ERROR
+	}
+	err = svc.db.DB.Create(&model.Identity{
+		UserID:  player.UserId,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	}).Error
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "Error 1062 (23000): Duplicate entry") {
+			return custom_errors.IDENTITY_EXIST_ERROR
+		}
+		return err
+	}
+	svc.log.Info("identity ", identity.Issuer, " ", identity.Subject, " linked to player ", player.UserId)
+	return nil
+}
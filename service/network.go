@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sushi/model"
+	"sushi/utils"
+	"sushi/utils/DB"
+	"sushi/utils/custom_errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const NETWORK_DIAL_TIMEOUT = 10 * time.Second
+
+// NetworkService manages the payment networks crawled by the worker. It only needs the
+// database so the CLI can use it without the rest of the service.
+type NetworkService struct {
+	db  *DB.DB
+	log *logrus.Logger
+}
+
+// NetworkUpdate holds the fields to change on a network, nil fields are kept.
+type NetworkUpdate struct {
+	ContractAddress    *string `json:"contract_address"`
+	Name               *string `json:"name"`
+	Decimals           *int64  `json:"decimals"`
+	Symbol             *string `json:"symbol"`
+	RpcUrl             *string `json:"rpc_url"`
+	ABI                *string `json:"abi"`
+	Confirmations      *uint64 `json:"confirmations"`
+	BlockTime          *uint64 `json:"block_time"`
+	StartBlock         *uint64 `json:"start_block"`
+	NFTContractAddress *string `json:"nft_contract_address"`
+}
+
+func NewNetworkService(db *DB.DB, log *logrus.Logger) *NetworkService {
+	return &NetworkService{db: db, log: log}
+}
+
+func (svc *NetworkService) ListNetworks() ([]model.Network, error) {
+	networks := make([]model.Network, 0)
+	err := svc.db.DB.Order("chain_id").Find(&networks).Error
+	if err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+func (svc *NetworkService) GetNetwork(chainID int64) (*model.Network, error) {
+	var network model.Network
+	result := svc.db.DB.Where("chain_id = ?", chainID).Limit(1).Find(&network)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, custom_errors.NETWORK_NOT_FOUND_ERROR
+	}
+	return &network, nil
+}
+
+// CreateNetwork validates network against its RPC and stores it. The worker crawls one
+// network per chain id.
+func (svc *NetworkService) CreateNetwork(ctx context.Context, network *model.Network) error {
+	network.ContractAddress = strings.TrimSpace(network.ContractAddress)
+	err := svc.ValidateNetwork(ctx, network)
+	if err != nil {
+		return err
+	}
+
+	return svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&model.Network{}).
+			Where("chain_id = ? OR lower(contract_address) = lower(?)", network.ChainID, network.ContractAddress).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return custom_errors.NETWORK_EXIST_ERROR
+		}
+		err = tx.Create(network).Error
+		if err != nil {
+			return err
+		}
+		svc.log.Info("network created: ", network.Name, " (chain ", network.ChainID, ")")
+		return nil
+	})
+}
+
+// UpdateNetwork applies update to the network of chainID, validating the result first.
+// The chain id itself cannot change; create a new network instead.
+func (svc *NetworkService) UpdateNetwork(ctx context.Context, chainID int64, update NetworkUpdate) (*model.Network, error) {
+	network, err := svc.GetNetwork(chainID)
+	if err != nil {
+		return nil, err
+	}
+	contractAddress := network.ContractAddress
+
+	if update.ContractAddress != nil {
+		network.ContractAddress = strings.TrimSpace(*update.ContractAddress)
+	}
+	if update.Name != nil {
+		network.Name = *update.Name
+	}
+	if update.Decimals != nil {
+		network.Decimals = *update.Decimals
+	}
+	if update.Symbol != nil {
+		network.Symbol = *update.Symbol
+	}
+	if update.RpcUrl != nil {
+		network.RpcUrl = *update.RpcUrl
+	}
+	if update.ABI != nil {
+		network.ABI = *update.ABI
+	}
+	if update.Confirmations != nil {
+		network.Confirmations = *update.Confirmations
+	}
+	if update.BlockTime != nil {
+		network.BlockTime = *update.BlockTime
+	}
+	if update.StartBlock != nil {
+		network.StartBlock = *update.StartBlock
+	}
+	if update.NFTContractAddress != nil {
+		network.NFTContractAddress = strings.TrimSpace(*update.NFTContractAddress)
+	}
+
+	err = svc.ValidateNetwork(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	err = svc.db.DB.Model(&model.Network{}).
+		Where("chain_id = ? AND contract_address = ?", chainID, contractAddress).
+		Select("*").
+		Updates(network).Error
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "Error 1062 (23000): Duplicate entry") {
+			return nil, custom_errors.NETWORK_EXIST_ERROR
+		}
+		return nil, err
+	}
+	svc.log.Info("network updated: ", network.Name, " (chain ", network.ChainID, ")")
+	return network, nil
+}
+
+// ValidateNetwork checks everything the worker needs to crawl network: the contract addresses,
+// an ABI with a PaymentReceived event, and an RPC that reports the same chain id and has code
+// at the contract address.
+func (svc *NetworkService) ValidateNetwork(ctx context.Context, network *model.Network) error {
+	if network.ChainID <= 0 {
+		return fmt.Errorf("%w: chain id is required", custom_errors.INVALID_NETWORK_ERROR)
+	}
+	if !common.IsHexAddress(network.ContractAddress) {
+		return fmt.Errorf("%w: contract address %q is not an address", custom_errors.INVALID_NETWORK_ERROR, network.ContractAddress)
+	}
+	if network.NFTContractAddress != "" && !common.IsHexAddress(network.NFTContractAddress) {
+		return fmt.Errorf("%w: nft contract address %q is not an address", custom_errors.INVALID_NETWORK_ERROR, network.NFTContractAddress)
+	}
+
+	contractAbi, err := abi.JSON(strings.NewReader(network.ABI))
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse ABI: %v", custom_errors.INVALID_NETWORK_ERROR, err)
+	}
+	if _, ok := contractAbi.Events["PaymentReceived"]; !ok {
+		return fmt.Errorf("%w: ABI has no PaymentReceived event", custom_errors.INVALID_NETWORK_ERROR)
+	}
+
+	if network.RpcUrl == "" {
+		return fmt.Errorf("%w: rpc url is required", custom_errors.INVALID_NETWORK_ERROR)
+	}
+	ctx, cancel := context.WithTimeout(ctx, NETWORK_DIAL_TIMEOUT)
+	defer cancel()
+	client, err := ethclient.DialContext(ctx, network.RpcUrl)
+	if err != nil {
+		return fmt.Errorf("%w: failed to connect to rpc: %v", custom_errors.INVALID_NETWORK_ERROR, err)
+	}
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get chain id from rpc: %v", custom_errors.INVALID_NETWORK_ERROR, err)
+	}
+	if chainID.Int64() != network.ChainID {
+		return fmt.Errorf("%w: rpc is on chain %s, expected %d", custom_errors.INVALID_NETWORK_ERROR, chainID, network.ChainID)
+	}
+	code, err := client.CodeAt(ctx, common.HexToAddress(network.ContractAddress), nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get contract code: %v", custom_errors.INVALID_NETWORK_ERROR, err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("%w: no contract at %s", custom_errors.INVALID_NETWORK_ERROR, network.ContractAddress)
+	}
+	return nil
+}
+
+func (svc *NetworkService) ListPrices(chainID int64) ([]model.Price, error) {
+	_, err := svc.GetNetwork(chainID)
+	if err != nil {
+		return nil, err
+	}
+	prices := make([]model.Price, 0)
+	err = svc.db.DB.Where("chain_id = ?", chainID).Order("token_address").Find(&prices).Error
+	if err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// SetPrice creates or replaces the price of a token on a network.
+func (svc *NetworkService) SetPrice(price *model.Price) error {
+	_, err := svc.GetNetwork(price.ChainID)
+	if err != nil {
+		return err
+	}
+	if !common.IsHexAddress(price.TokenAddress) {
+		return fmt.Errorf("%w: token address %q is not an address", custom_errors.INVALID_PRICE_ERROR, price.TokenAddress)
+	}
+	minAmount, ok := utils.ParseAmount(price.MinAmount)
+	if !ok || minAmount.Sign() == 0 || price.Duration == 0 {
+		return fmt.Errorf("%w: min amount and duration must be positive integers", custom_errors.INVALID_PRICE_ERROR)
+	}
+	price.MinAmount = minAmount.String()
+	price.TokenAddress = common.HexToAddress(price.TokenAddress).Hex()
+
+	return svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("chain_id = ? AND lower(token_address) = lower(?)", price.ChainID, price.TokenAddress).Delete(&model.Price{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(price).Error
+		if err != nil {
+			return err
+		}
+		svc.log.Info("price set on chain ", price.ChainID, ": ", price.MinAmount, " of ", price.TokenAddress, " for ", price.Duration, "s")
+		return nil
+	})
+}
+
+func (svc *NetworkService) DeletePrice(chainID int64, tokenAddress string) error {
+	result := svc.db.DB.Where("chain_id = ? AND lower(token_address) = lower(?)", chainID, tokenAddress).Delete(&model.Price{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return custom_errors.PRICE_NOT_FOUND_ERROR
+	}
+	svc.log.Info("price deleted on chain ", chainID, ": ", tokenAddress)
+	return nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sushi/model"
+	"sushi/utils/custom_errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PlayerExport is everything stored about a player, for GET /v1/me/export.
+type PlayerExport struct {
+	Player          model.Player           `json:"player"`
+	Signup          *model.Signup          `json:"signup"` // nil for players registered before signups were recorded
+	Identities      []model.Identity       `json:"identities"`
+	Wallets         []model.PlayerWallet   `json:"wallets"`
+	WalletHistory   []model.WalletHistory  `json:"wallet_history"`
+	EarnTotal       model.EarnTotal        `json:"earn_total"`
+	SwapTotal       model.SwapTotal        `json:"swap_total"`
+	WithdrawTotal   model.WithdrawTotal    `json:"withdraw_total"`
+	EarnRecords     []model.EarnRecord     `json:"earn_records"`
+	SwapRecords     []model.SwapRecord     `json:"swap_records"`
+	WithdrawRecords []model.WithdrawRecord `json:"withdraw_records"`
+	FreebieRecords  []model.FreeBieRecord  `json:"freebie_records"`
+	Recharges       []model.RechargeNFT    `json:"recharges"`
+	Subscriptions   []model.Subscription   `json:"subscriptions"`
+	ExportedAt      time.Time              `json:"exported_at"`
+}
+
+func (svc *Service) ExportPlayer(sub string) (*PlayerExport, error) {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return nil, custom_errors.PLAYER_NOT_EXIST_ERROR
+	}
+	export := PlayerExport{
+		Player:          player,
+		Identities:      make([]model.Identity, 0),
+		Wallets:         make([]model.PlayerWallet, 0),
+		WalletHistory:   make([]model.WalletHistory, 0),
+		EarnRecords:     make([]model.EarnRecord, 0),
+		SwapRecords:     make([]model.SwapRecord, 0),
+		WithdrawRecords: make([]model.WithdrawRecord, 0),
+		FreebieRecords:  make([]model.FreeBieRecord, 0),
+		Recharges:       make([]model.RechargeNFT, 0),
+		Subscriptions:   make([]model.Subscription, 0),
+		ExportedAt:      time.Now().UTC(),
+	}
+
+	tables := []interface{}{
+		&export.Identities, &export.Wallets, &export.WalletHistory,
+		&export.EarnTotal, &export.SwapTotal, &export.WithdrawTotal,
+		&export.EarnRecords, &export.SwapRecords, &export.WithdrawRecords, &export.FreebieRecords,
+	}
+	for _, rows := range tables {
+		err = svc.db.DB.Where("user_id = ?", player.UserId).Find(rows).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var signup model.Signup
+	result := svc.db.DB.Where("user_id = ?", player.UserId).Limit(1).Find(&signup)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		export.Signup = &signup
+	}
+
+	// payments are keyed by payer address, not by player
+	addresses, err := svc.walletAddresses(player.UserId)
+	if err != nil {
+		return nil, err
+	}
+	for i, address := range addresses {
+		addresses[i] = strings.ToLower(address)
+	}
+	if len(addresses) > 0 {
+		err = svc.db.DB.Where("lower(payer) IN ?", addresses).Order("created_at").Find(&export.Recharges).Error
+		if err != nil {
+			return nil, err
+		}
+		err = svc.db.DB.Where("lower(payer) IN ?", addresses).Find(&export.Subscriptions).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &export, nil
+}
+
+// DeletePlayer anonymises the player of sub: its mail, sub and wallets are removed along with
+// its identities and signup, so its logins no longer reach it. Balances, records and payments are kept for
+// the ledger under the bare user id, withdrawals without their address. The unlinks of its
+// wallets are purged by the worker after the cooldown. With deleteLogin the Firebase accounts of
+// the player are deleted too.
+func (svc *Service) DeletePlayer(ctx context.Context, sub string, deleteLogin bool) error {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return custom_errors.PLAYER_NOT_EXIST_ERROR
+	}
+
+	var uids []string
+	err = svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		// the tx server still needs the player's withdrawals in flight
+		var pending int64
+		err := tx.Model(&model.WithdrawRecord{}).Where("user_id = ? AND state IN (0, 1)", player.UserId).Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return custom_errors.WITHDRAW_PENDING_ERROR
+		}
+		err = tx.Model(&model.WithdrawRecord{}).Where("user_id = ?", player.UserId).Update("address", "").Error
+		if err != nil {
+			return err
+		}
+
+		var identities []model.Identity
+		err = tx.Where("user_id = ?", player.UserId).Find(&identities).Error
+		if err != nil {
+			return err
+		}
+		uids = svc.firebaseUIDs(player, identities)
+
+		var wallets []model.PlayerWallet
+		err = tx.Where("user_id = ?", player.UserId).Find(&wallets).Error
+		if err != nil {
+			return err
+		}
+		// only the unlinks are kept, they reserve the addresses for the cooldown
+		err = tx.Where("user_id = ?", player.UserId).Delete(&model.WalletHistory{}).Error
+		if err != nil {
+			return err
+		}
+		for _, wallet := range wallets {
+			err = svc.recordWallet(tx, player.UserId, wallet.Address, model.WalletUnlinked)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, table := range []interface{}{&model.PlayerWallet{}, &model.WalletProof{}, &model.WalletNonce{}, &model.Identity{}, &model.Signup{}} {
+			err = tx.Where("user_id = ?", player.UserId).Delete(table).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.Player{}).Where("user_id = ?", player.UserId).Updates(map[string]interface{}{
+			"mail":          "",
+			"sub":           fmt.Sprintf("deleted:%d", player.UserId),
+			"eth_address":   nil,
+			"anonymised_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	svc.log.Info("player ", player.UserId, " deleted")
+
+	if deleteLogin {
+		svc.deleteFirebaseUsers(ctx, player.UserId, uids)
+	}
+	return nil
+}
+
+// firebaseUIDs returns the Firebase accounts among the identities of a player. Players created
+// before identities were recorded are keyed on their Firebase uid.
+func (svc *Service) firebaseUIDs(player model.Player, identities []model.Identity) []string {
+	if svc.Firebase.Verifier == nil {
+		return nil
+	}
+	var uids []string
+	for _, identity := range identities {
+		if identity.Issuer == svc.Firebase.Verifier.Issuer() {
+			uids = append(uids, identity.Subject)
+		}
+	}
+	if len(identities) == 0 && !strings.Contains(player.Sub, ":") {
+		uids = append(uids, player.Sub)
+	}
+	return uids
+}
+
+// deleteFirebaseUsers deletes Firebase accounts after their player was deleted. Failures are
+// only logged: the player is gone either way.
+func (svc *Service) deleteFirebaseUsers(ctx context.Context, userId uint, uids []string) {
+	if svc.Firebase.Auth == nil {
+		svc.log.Warn("firebase is not initialized, logins of player ", userId, " are not deleted")
+		return
+	}
+	for _, uid := range uids {
+		err := svc.Firebase.Auth.DeleteUser(ctx, uid)
+		if err != nil {
+			svc.log.Error("failed to delete firebase user of player ", userId, ": ", err)
+			continue
+		}
+		svc.log.Info("firebase user of player ", userId, " deleted")
+	}
+}
@@ -25,6 +25,8 @@ type Service struct {
 	swapLimit float64
 	Firebase  *utils.Firebase
 	Ctx       *context.Context
+	Networks  *NetworkService
+	APIKeys   *APIKeyService
 }
 
 func (svc *Service) GetRate() float64 {
@@ -84,7 +86,19 @@ func (svc *Service) GetBalance(sub string) (float64, float64, error) {
 }
 
 func NewService(db *DB.DB, log *logrus.Logger, conf *config.Config, ctx context.Context) *Service {
-	_firebase := utils.NewFirebase(ctx)
+	_firebase := &utils.Firebase{}
+	if conf.AuthMode() == "firebase" {
+		verifier, err := utils.StartFirebaseVerifier(ctx, conf.FirebaseProjectID(), log)
+		if err != nil {
+			log.Error("failed to initialize the firebase token verifier: ", err)
+		}
+		_firebase, err = utils.NewFirebase(ctx, conf.FirebaseProjectID())
+		if err != nil {
+			log.Error("failed to initialize firebase: ", err)
+			_firebase = &utils.Firebase{}
+		}
+		_firebase.Verifier = verifier
+	}
 	return &Service{
 		db:        db,
 		log:       log,
@@ -93,40 +107,61 @@ func NewService(db *DB.DB, log *logrus.Logger, conf *config.Config, ctx context.
 		swapLimit: 10,
 		Firebase:  _firebase,
 		Ctx:       &ctx,
+		Networks:  NewNetworkService(db, log),
+		APIKeys:   NewAPIKeyService(db, log),
 	}
 }
 
-func (svc *Service) NewPlayer(mail string, sub string) error {
+// Registration is what a player sends when signing up, recorded in signups.
+type Registration struct {
+	Region        uint   `json:"region"`
+	ReferralCode  string `json:"referral_code"`
+	ClientVersion string `json:"client_version"`
+	TermsVersion  string `json:"terms_version"`
+}
+
+// NewPlayer registers the player of sub. It is the only way players are created.
+func (svc *Service) NewPlayer(mail string, sub string, registration Registration) (*model.Player, error) {
 	var er error
 	var player model.Player
 
-	err := svc.checkPlayer(mail)
+	if registration.TermsVersion == "" ||
+		(svc.conf.TermsVersion() != "" && registration.TermsVersion != svc.conf.TermsVersion()) {
+		return nil, custom_errors.TERMS_NOT_ACCEPTED_ERROR
+	}
+	err := svc.checkPlayer(sub)
 	if !errors.Is(err, custom_errors.PLAYER_NOT_EXIST_ERROR) {
 		//Player exist
-		return custom_errors.PLAYER_EXIST_ERROR
+		return nil, custom_errors.PLAYER_EXIST_ERROR
 	}
 	err = svc.db.DB.Transaction(func(tx *gorm.DB) error {
 
-		er = svc.createPlayer(mail, sub)
+		player, er = svc.createPlayer(tx, mail, sub, registration.Region)
 		if er != nil {
 			return er
 		}
 
-		player, er = svc.getPlayerBySub(sub)
+		er = tx.Create(&model.Signup{
+			UserID:        player.UserId,
+			Region:        registration.Region,
+			ReferralCode:  registration.ReferralCode,
+			ClientVersion: registration.ClientVersion,
+			TermsVersion:  registration.TermsVersion,
+		}).Error
 		if er != nil {
 			return er
 		}
 
-		er = svc.createSpeakTotal(player.UserId)
+		er = svc.createSpeakTotal(tx, player.UserId)
 		if er != nil {
 			return er
 		}
 
-		er = svc.createFoodTotal(player.UserId)
+		er = svc.createFoodTotal(tx, player.UserId)
 		if er != nil {
 			return er
 		}
-		er = svc.createSwapTotal(player.UserId)
+		er = svc.createSwapTotal(tx, player.UserId)
 		if er != nil {
 			return er
 		}
@@ -135,10 +170,10 @@ func (svc *Service) NewPlayer(mail string, sub string) error {
 	})
 	if err != nil {
 		svc.log.Error("Failed to create new player: ", mail)
-		return err
+		return nil, err
 	}
 	svc.log.Info("New player:", mail)
-	return nil
+	return &player, nil
 }
 
 func (svc *Service) Earn(players []model.EarnPlayer, sessionId string) error {
@@ -233,11 +268,20 @@ func (svc *Service) ApplyWithdraw(sub string, speakAmount float64) error {
 	if speak < speakAmount {
 		return custom_errors.SPEAK_NOT_ENOUGH_ERROR
 	}
+	// withdrawals go to the primary wallet at the time of the request
+	var address string
+	if player.EthAddress != nil {
+		address = *player.EthAddress
+		err = svc.checkWithdrawAddress(svc.db.DB, player.UserId, address)
+		if err != nil {
+			return err
+		}
+	}
 
 	err = svc.db.DB.Transaction(func(tx *gorm.DB) error {
 		var er error
 
-		er = svc.addWithdrawRecord(player.UserId, speakAmount)
+		er = svc.addWithdrawRecord(player.UserId, address, speakAmount)
 		if er != nil {
 			return er
 		}
@@ -336,27 +380,28 @@ func (svc *Service) WithDrawFail(withdrawId uint) error {
 
 }
 
-func (svc *Service) createPlayer(mail string, sub string) error {
+func (svc *Service) createPlayer(tx *gorm.DB, mail string, sub string, region uint) (model.Player, error) {
 	player := model.Player{
+		Region:     region,
 		Mail:       mail,
 		Sub:        sub,
 		EthAddress: nil,
 		LoginAt:    time.Now(),
 	}
-	result := svc.db.DB.Create(&player)
+	result := tx.Create(&player)
 	if result.Error != nil {
 		//svc.log.Error("CreatePlayerError:")
-		return result.Error
+		return model.Player{}, result.Error
 	}
-	return nil
+	return player, nil
 }
 
-func (svc *Service) createFoodTotal(userId uint) error {
+func (svc *Service) createFoodTotal(tx *gorm.DB, userId uint) error {
 	foodTotal := model.EarnTotal{
 		UserID:    userId,
 		EarnTotal: 0,
 	}
-	result := svc.db.DB.Create(&foodTotal)
+	result := tx.Create(&foodTotal)
 
 	if result.Error != nil {
 		//svc.log.Error("CreateBalanceError:")
@@ -365,23 +410,23 @@ func (svc *Service) createFoodTotal(userId uint) error {
 	return nil
 }
 
-func (svc *Service) createSpeakTotal(userId uint) error {
+func (svc *Service) createSpeakTotal(tx *gorm.DB, userId uint) error {
 	speakTotal := model.WithdrawTotal{
 		UserID:        userId,
 		WithdrawTotal: 0,
 	}
-	result := svc.db.DB.Create(&speakTotal)
+	result := tx.Create(&speakTotal)
 	if result.Error != nil {
 		//svc.log.Error("CreateBalanceError:")
 		return result.Error
 	}
 	return nil
 }
-func (svc *Service) createSwapTotal(userId uint) error {
+func (svc *Service) createSwapTotal(tx *gorm.DB, userId uint) error {
 	swapTotal := model.SwapTotal{
 		UserID: userId,
 	}
-	result := svc.db.DB.Create(&swapTotal)
+	result := tx.Create(&swapTotal)
 	if result.Error != nil {
 		//svc.log.Error("CreateBalanceError:")
 		return result.Error
@@ -483,11 +528,12 @@ func (svc *Service) addSwapRecord(userId uint, foodAmount float64, speakAmount f
 	return nil
 }
 
-func (svc *Service) addWithdrawRecord(userId uint, speakAmount float64) error {
+func (svc *Service) addWithdrawRecord(userId uint, address string, speakAmount float64) error {
 
 	withdrawRecord := model.WithdrawRecord{
 		UserID:           userId,
 		Amount:           speakAmount,
+		Address:          address,
 		State:            0, //0pending,1success,2fail
 		Hash:             "",
 		HandleTimestamp:  nil,
@@ -678,37 +724,17 @@ func (svc *Service) getSwapTotalByUserid(userid uint) (float64, float64, error)
 	return swapTotal.SwappedFood, swapTotal.SwappedSpeak, nil
 }
 
-func (svc *Service) GetUserInfo(mail string, sub string) (*model.Player, error) {
-	var player model.Player
-
+// GetUserInfo returns the player of sub, PLAYER_NOT_EXIST_ERROR until they registered.
+func (svc *Service) GetUserInfo(sub string) (*model.Player, error) {
 	err := svc.checkPlayer(sub)
-	if errors.Is(err, custom_errors.PLAYER_NOT_EXIST_ERROR) {
-		err = svc.NewPlayer(mail, sub)
-		if err != nil {
-			return nil, err
-		}
-	}
-	player, err = svc.getPlayerBySub(sub)
 	if err != nil {
 		return nil, err
 	}
-	return &player, nil
-}
-
-func (svc *Service) EditEthAddress(sub string, ethAddress string) error {
-	var player model.Player
 	player, err := svc.getPlayerBySub(sub)
 	if err != nil {
-		return err
-	}
-	err = svc.db.DB.Model(&player).Update("eth_address", ethAddress).Error
-	if err != nil {
-		if strings.HasPrefix(err.Error(), "Error 1062 (23000): Duplicate entry") {
-			return custom_errors.ETH_ADDRESS_EXIST_ERROR
-		}
-		return err
+		return nil, err
 	}
-	return nil
+	return &player, nil
 }
 
 type Data struct {
@@ -721,9 +747,9 @@ type Data struct {
 
 type NFTWithRecharge struct {
 	model.NFT
-	Balance    int64 `json:"balance"`
-	Amount     int64 `json:"rechargeAmount"`
-	ExpiryDate int64 `json:"expiryDate"`
+	Balance    int64  `json:"balance"`
+	Amount     string `json:"rechargeAmount"`
+	ExpiryDate int64  `json:"expiryDate"`
 }
 
 type NFT struct {
@@ -746,17 +772,28 @@ func (svc *Service) GetUserNfts(sub string, page int, limit int) (*Data, error)
 	if err != nil {
 		return nil, err
 	}
-	if player.EthAddress == nil {
+	wallets, err := svc.walletAddresses(player.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if len(wallets) == 0 {
 		return &Data{}, nil
 	}
+	// owners are stored lowercase
+	owners := make([]string, 0, len(wallets))
+	for _, wallet := range wallets {
+		owners = append(owners, strings.ToLower(wallet))
+	}
 
+	// balances and expiries are summed up across the player's wallets
 	queryNFTs := svc.db.DB.Table("nfts").
-		Select("*").
-		Joins("LEFT JOIN owners ON owners.token_id = nfts.token_id AND owners.token_type = nfts.token_type AND lower(owners.address) = lower(?)", *player.EthAddress).
-		Joins("LEFT JOIN (SELECT token_id, MAX(created_at) AS latest_created_at FROM recharge_nfts WHERE payer = ? AND status = ? GROUP BY token_id) AS latest_recharge ON nfts.token_id = latest_recharge.token_id", *player.EthAddress, model.Confirmed).
-		Joins("LEFT JOIN recharge_nfts ON nfts.token_id = recharge_nfts.token_id AND recharge_nfts.created_at = latest_recharge.latest_created_at").
-		Where("lower(owners.address) = lower(?) AND owners.token_type= ?", *player.EthAddress, svc.conf.TokenType()).
-		Or("lower(recharge_nfts.payer) = lower(?) AND nfts.token_type= ?", *player.EthAddress, svc.conf.TokenType()).
+		Select("nfts.*, owned.balance, recharge_nfts.amount, subscribed.expiry_date").
+		Joins("LEFT JOIN (SELECT contract_id, token_id, SUM(balance) AS balance FROM owners WHERE address IN ? AND generation = (SELECT active FROM owner_generations WHERE owner_generations.contract_id = owners.contract_id) GROUP BY contract_id, token_id) AS owned ON owned.token_id = nfts.token_id AND owned.contract_id = nfts.contract_id", owners).
+		Joins("JOIN contracts ON contracts.contract_id = nfts.contract_id AND contracts.tracked = ?", true).
+		Joins("LEFT JOIN (SELECT contract_address, token_id, MAX(expiry_date) AS expiry_date FROM subscriptions WHERE payer IN ? GROUP BY contract_address, token_id) AS subscribed ON lower(subscribed.contract_address) = lower(contracts.address) AND nfts.token_id = subscribed.token_id", wallets).
+		Joins("LEFT JOIN (SELECT contract_address, token_id, MAX(created_at) AS latest_created_at FROM recharge_nfts WHERE payer IN ? AND status = ? AND reject_reason = '' GROUP BY contract_address, token_id) AS latest_recharge ON lower(latest_recharge.contract_address) = lower(contracts.address) AND nfts.token_id = latest_recharge.token_id", wallets, model.Confirmed).
+		Joins("LEFT JOIN recharge_nfts ON lower(recharge_nfts.contract_address) = lower(contracts.address) AND nfts.token_id = recharge_nfts.token_id AND recharge_nfts.created_at = latest_recharge.latest_created_at AND recharge_nfts.payer IN ? AND recharge_nfts.status = ? AND recharge_nfts.reject_reason = ''", wallets, model.Confirmed).
+		Where("owned.token_id IS NOT NULL OR subscribed.token_id IS NOT NULL").
 		Count(&count).
 		Offset(int((page - 1) * limit)).
 		Limit(limit).
@@ -779,11 +816,11 @@ func (svc *Service) GetUserNfts(sub string, page int, limit int) (*Data, error)
 		if query.Error != nil {
 			return nil, err
 		}
-		query = svc.db.DB.Where("token_id = ? and token_type = ?", nft.TokenId, svc.conf.TokenType()).First(&image)
+		query = svc.db.DB.Where("token_id = ? and contract_id = ?", nft.TokenId, nft.ContractID).First(&image)
 		if query.Error != nil {
 			return nil, err
 		}
-		query = svc.db.DB.Where("token_id = ? and token_type = ?", nft.TokenId, svc.conf.TokenType()).Find(&attributes)
+		query = svc.db.DB.Where("token_id = ? and contract_id = ?", nft.TokenId, nft.ContractID).Find(&attributes)
 		if query.Error != nil {
 			return nil, err
 		}
@@ -805,15 +842,18 @@ func (svc *Service) GetUserNfts(sub string, page int, limit int) (*Data, error)
 }
 
 func (svc *Service) CheckPaidPlayer(player model.Player) (err error) {
-	if player.EthAddress == nil {
+	wallets, err := svc.walletAddresses(player.UserId)
+	if err != nil {
+		return err
+	}
+	if len(wallets) == 0 {
 		return custom_errors.PLAYER_ETH_ADDRESS_EXIST_ERROR
 	}
 	var count int64
 	queryNFTs := svc.db.DB.Table("nfts").
-		// Joins("LEFT JOIN owners ON owners.token_id = nfts.token_id").
-		Joins("LEFT JOIN recharge_nfts ON nfts.token_id = recharge_nfts.token_id AND recharge_nfts.payer = ? ", *player.EthAddress).
-		// Where("lower(owners.address) = lower(?)", *player.EthAddress).
-		Where("lower(recharge_nfts.payer) = lower(?) AND recharge_nfts.status = ? AND recharge_nfts.expiry_date > UNIX_TIMESTAMP(NOW())", *player.EthAddress, model.Confirmed).
+		Joins("JOIN contracts ON contracts.contract_id = nfts.contract_id").
+		Joins("JOIN subscriptions ON lower(subscriptions.contract_address) = lower(contracts.address) AND nfts.token_id = subscriptions.token_id").
+		Where("subscriptions.payer IN ? AND subscriptions.expiry_date > UNIX_TIMESTAMP(NOW())", wallets).
 		Count(&count)
 	if queryNFTs.Error != nil {
 		return queryNFTs.Error
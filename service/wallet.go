@@ -0,0 +1,390 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sushi/model"
+	"sushi/utils"
+	"sushi/utils/custom_errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+const SIWE_NONCE_TTL = 10 * time.Minute
+
+type WalletNonce struct {
+	Nonce      string `json:"nonce"`
+	Domain     string `json:"domain"`
+	ExpiryDate uint64 `json:"expiry_date"`
+}
+
+// NewWalletNonce issues the nonce the player's next Sign-In With Ethereum message must carry.
+func (svc *Service) NewWalletNonce(sub string) (*WalletNonce, error) {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return nil, err
+	}
+	// drop the nonces the player never used
+	err = svc.db.DB.Where("user_id = ? AND expiry_date <= ?", player.UserId, time.Now().Unix()).Delete(&model.WalletNonce{}).Error
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 16)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	nonce := model.WalletNonce{
+		Nonce:      hex.EncodeToString(buf),
+		UserID:     player.UserId,
+		ExpiryDate: uint64(time.Now().Add(SIWE_NONCE_TTL).Unix()),
+	}
+	err = svc.db.DB.Create(&nonce).Error
+	if err != nil {
+		return nil, err
+	}
+	return &WalletNonce{Nonce: nonce.Nonce, Domain: svc.conf.SiweDomain(), ExpiryDate: nonce.ExpiryDate}, nil
+}
+
+// VerifyEthAddress checks a Sign-In With Ethereum message signed by the player's wallet and
+// adds the signing address to the player's wallets.
+func (svc *Service) VerifyEthAddress(sub string, message string, signature string) (*model.PlayerWallet, error) {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return nil, err
+	}
+	siwe, err := utils.ParseSiweMessage(message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", custom_errors.INVALID_SIWE_MESSAGE_ERROR, err)
+	}
+	err = siwe.Verify(svc.conf.SiweDomain(), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", custom_errors.INVALID_SIWE_MESSAGE_ERROR, err)
+	}
+
+	// the nonce is spent even if the signature turns out wrong
+	err = spendWalletNonce(svc.db.DB, player.UserId, siwe.Nonce, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := utils.RecoverSiweSigner(message, signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", custom_errors.INVALID_SIWE_MESSAGE_ERROR, err)
+	}
+	if signer != siwe.Address {
+		return nil, fmt.Errorf("%w: signed by %s, not %s", custom_errors.INVALID_SIWE_MESSAGE_ERROR, signer.Hex(), siwe.Address.Hex())
+	}
+
+	var wallet *model.PlayerWallet
+	err = svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND address = ?", player.UserId, signer.Hex()).Delete(&model.WalletProof{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(&model.WalletProof{UserID: player.UserId, Address: signer.Hex(), ChainID: siwe.ChainID}).Error
+		if err != nil {
+			return err
+		}
+		wallet, err = svc.addWallet(tx, player, signer.Hex())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// spendWalletNonce deletes a nonce issued to the player that is still valid at now, so every
+// nonce verifies one message only.
+func spendWalletNonce(db *gorm.DB, userId uint, nonce string, now time.Time) error {
+	result := db.Where("nonce = ? AND user_id = ? AND expiry_date > ?", nonce, userId, now.Unix()).
+		Delete(&model.WalletNonce{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return custom_errors.INVALID_NONCE_ERROR
+	}
+	return nil
+}
+
+// EditEthAddress links ethAddress, stored checksummed, to the player as their primary wallet.
+// The player must have proven the address with VerifyEthAddress.
+func (svc *Service) EditEthAddress(sub string, ethAddress string) error {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return err
+	}
+	return svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		wallet, err := svc.addWallet(tx, player, common.HexToAddress(ethAddress).Hex())
+		if err != nil {
+			return err
+		}
+		return svc.setPrimaryWallet(tx, player.UserId, wallet.Address)
+	})
+}
+
+func (svc *Service) ListWallets(sub string) ([]model.PlayerWallet, error) {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return nil, err
+	}
+	wallets := make([]model.PlayerWallet, 0)
+	err = svc.db.DB.Where("user_id = ?", player.UserId).Order("is_primary DESC, created_at").Find(&wallets).Error
+	if err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
+
+// AddWallet links a proven address to the player, as primary if it is their first wallet.
+func (svc *Service) AddWallet(sub string, ethAddress string) (*model.PlayerWallet, error) {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return nil, err
+	}
+	var wallet *model.PlayerWallet
+	err = svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		wallet, err = svc.addWallet(tx, player, common.HexToAddress(ethAddress).Hex())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// RemoveWallet unlinks an address from the player. Removing the primary wallet promotes the
+// oldest remaining one.
+func (svc *Service) RemoveWallet(sub string, ethAddress string) error {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return err
+	}
+	return svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		wallet, err := svc.getWallet(tx, player.UserId, ethAddress)
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(wallet).Error
+		if err != nil {
+			return err
+		}
+		err = svc.recordWallet(tx, player.UserId, wallet.Address, model.WalletUnlinked)
+		if err != nil {
+			return err
+		}
+		svc.log.Info("wallet ", wallet.Address, " removed from player ", player.UserId)
+		if !wallet.IsPrimary {
+			return nil
+		}
+
+		var next model.PlayerWallet
+		result := tx.Where("user_id = ?", player.UserId).Order("created_at").Limit(1).Find(&next)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tx.Model(&model.Player{}).Where("user_id = ?", player.UserId).Update("eth_address", nil).Error
+		}
+		return svc.setPrimaryWallet(tx, player.UserId, next.Address)
+	})
+}
+
+func (svc *Service) SetPrimaryWallet(sub string, ethAddress string) error {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return err
+	}
+	return svc.db.DB.Transaction(func(tx *gorm.DB) error {
+		wallet, err := svc.getWallet(tx, player.UserId, ethAddress)
+		if err != nil {
+			return err
+		}
+		return svc.setPrimaryWallet(tx, player.UserId, wallet.Address)
+	})
+}
+
+func (svc *Service) getWallet(tx *gorm.DB, userId uint, ethAddress string) (*model.PlayerWallet, error) {
+	var wallet model.PlayerWallet
+	result := tx.Where("user_id = ? AND lower(address) = lower(?)", userId, ethAddress).Limit(1).Find(&wallet)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, custom_errors.WALLET_NOT_FOUND_ERROR
+	}
+	return &wallet, nil
+}
+
+// addWallet links a checksummed address the player proved, then applies what it already paid
+// for. An address already linked to the player is returned as is.
+func (svc *Service) addWallet(tx *gorm.DB, player model.Player, ethAddress string) (*model.PlayerWallet, error) {
+	var proof model.WalletProof
+	result := tx.Where("user_id = ? AND address = ?", player.UserId, ethAddress).Limit(1).Find(&proof)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, custom_errors.ETH_ADDRESS_NOT_PROVEN_ERROR
+	}
+
+	var wallet model.PlayerWallet
+	result = tx.Where("lower(address) = lower(?)", ethAddress).Limit(1).Find(&wallet)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		if wallet.UserID != player.UserId {
+			return nil, custom_errors.ETH_ADDRESS_EXIST_ERROR
+		}
+		return &wallet, nil
+	}
+
+	// an unlinked address stays reserved for its player for a while
+	var count int64
+	err := tx.Model(&model.WalletHistory{}).
+		Where("lower(address) = lower(?) AND user_id <> ? AND action = ? AND created_at > ?",
+			ethAddress, player.UserId, model.WalletUnlinked, time.Now().Add(-time.Duration(svc.conf.WalletUnlinkCooldown())*time.Second)).
+		Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, custom_errors.WALLET_COOLDOWN_ERROR
+	}
+
+	err = tx.Model(&model.PlayerWallet{}).Where("user_id = ?", player.UserId).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	wallet = model.PlayerWallet{
+		UserID:     player.UserId,
+		Address:    ethAddress,
+		ChainID:    proof.ChainID,
+		VerifiedAt: &proof.CreatedAt,
+		IsPrimary:  count == 0,
+	}
+	err = tx.Create(&wallet).Error
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "Error 1062 (23000): Duplicate entry") {
+			return nil, custom_errors.ETH_ADDRESS_EXIST_ERROR
+		}
+		return nil, err
+	}
+	err = svc.recordWallet(tx, player.UserId, wallet.Address, model.WalletLinked)
+	if err != nil {
+		return nil, err
+	}
+	if wallet.IsPrimary {
+		err = svc.setPrimaryWallet(tx, player.UserId, wallet.Address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	svc.log.Info("wallet ", wallet.Address, " added to player ", player.UserId)
+	return &wallet, svc.applyRecharges(tx, player.UserId, ethAddress)
+}
+
+// setPrimaryWallet makes ethAddress the primary wallet of the player and mirrors it in
+// players.eth_address.
+func (svc *Service) setPrimaryWallet(tx *gorm.DB, userId uint, ethAddress string) error {
+	var player model.Player
+	err := tx.Where("user_id = ?", userId).First(&player).Error
+	if err != nil {
+		return err
+	}
+	if player.EthAddress != nil && *player.EthAddress == ethAddress {
+		return nil
+	}
+	err = svc.recordWallet(tx, userId, ethAddress, model.WalletPrimary)
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&model.PlayerWallet{}).
+		Where("user_id = ?", userId).
+		Update("is_primary", gorm.Expr("address = ?", ethAddress)).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&model.Player{}).Where("user_id = ?", userId).Update("eth_address", ethAddress).Error
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "Error 1062 (23000): Duplicate entry") {
+			return custom_errors.ETH_ADDRESS_EXIST_ERROR
+		}
+		return err
+	}
+	return nil
+}
+
+func (svc *Service) recordWallet(tx *gorm.DB, userId uint, ethAddress string, action model.WalletAction) error {
+	return tx.Create(&model.WalletHistory{UserID: userId, Address: ethAddress, Action: action}).Error
+}
+
+func (svc *Service) GetWalletHistory(sub string) ([]model.WalletHistory, error) {
+	player, err := svc.getPlayerBySub(sub)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]model.WalletHistory, 0)
+	err = svc.db.DB.Where("user_id = ?", player.UserId).Order("id DESC").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// checkWithdrawAddress fails if ethAddress became the player's primary wallet too recently to
+// receive withdrawals. Wallets linked before history was kept are not locked.
+func (svc *Service) checkWithdrawAddress(tx *gorm.DB, userId uint, ethAddress string) error {
+	var count int64
+	err := tx.Model(&model.WalletHistory{}).
+		Where("user_id = ? AND address = ? AND action IN ? AND created_at > ?",
+			userId, ethAddress, []model.WalletAction{model.WalletLinked, model.WalletPrimary},
+			time.Now().Add(-time.Duration(svc.conf.WalletWithdrawDelay())*time.Second)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return custom_errors.WITHDRAW_ADDRESS_LOCKED_ERROR
+	}
+	return nil
+}
+
+// walletAddresses returns every address linked to the player.
+func (svc *Service) walletAddresses(userId uint) ([]string, error) {
+	addresses := make([]string, 0)
+	err := svc.db.DB.Model(&model.PlayerWallet{}).Where("user_id = ?", userId).Pluck("address", &addresses).Error
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// applyRecharges unlocks the current freebie period of a player whose address has a running
+// subscription, like the crawler does when the payment is confirmed after the address is linked.
+func (svc *Service) applyRecharges(tx *gorm.DB, userId uint, ethAddress string) error {
+	var count int64
+	err := tx.Model(&model.Subscription{}).
+		Where("lower(payer) = lower(?) AND expiry_date > UNIX_TIMESTAMP(NOW())", ethAddress).
+		Count(&count).Error
+	if err != nil || count == 0 {
+		return err
+	}
+	result := tx.Model(&model.FreebieEarnTotal{}).
+		Where("user_id = ? AND expiry_date > UNIX_TIMESTAMP(NOW()) AND charge_date <= 0", userId).
+		Update("charge_date", uint64(time.Now().Unix()))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		svc.log.Info("recharges of ", ethAddress, " applied to player ", userId)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sushi/model"
+	"sushi/utils/DB/dbtest"
+	"sushi/utils/custom_errors"
+)
+
+func TestSpendWalletNonce(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		userId uint
+		nonce  string
+		now    time.Time
+		err    error
+	}{
+		{"valid", 1, "fresh", now, nil},
+		{"unknown", 1, "unknown", now, custom_errors.INVALID_NONCE_ERROR},
+		{"other player", 2, "fresh", now, custom_errors.INVALID_NONCE_ERROR},
+		{"expired", 1, "fresh", now.Add(SIWE_NONCE_TTL), custom_errors.INVALID_NONCE_ERROR},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := dbtest.Open(t, &model.WalletNonce{})
+			err := db.Create(&model.WalletNonce{Nonce: "fresh", UserID: 1, ExpiryDate: uint64(now.Add(SIWE_NONCE_TTL).Unix())}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = spendWalletNonce(db, test.userId, test.nonce, test.now)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("spendWalletNonce() error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestSpendWalletNonceReused(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db := dbtest.Open(t, &model.WalletNonce{})
+	err := db.Create(&model.WalletNonce{Nonce: "fresh", UserID: 1, ExpiryDate: uint64(now.Add(SIWE_NONCE_TTL).Unix())}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spendWalletNonce(db, 1, "fresh", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spendWalletNonce(db, 1, "fresh", now)
+	if !errors.Is(err, custom_errors.INVALID_NONCE_ERROR) {
+		t.Fatalf("spendWalletNonce() error = %v for a reused nonce", err)
+	}
+}
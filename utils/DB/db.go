@@ -29,6 +29,10 @@ func NewDB_MySQL(log *logrus.Logger, DBPath string) *DB {
 	if err != nil {
 		return nil
 	}
+	err = _db.AutoMigrate(model.Signup{})
+	if err != nil {
+		return nil
+	}
 	err = _db.AutoMigrate(model.SwapTotal{})
 	if err != nil {
 		return nil
@@ -73,6 +77,10 @@ func NewDB_MySQL(log *logrus.Logger, DBPath string) *DB {
 	if err != nil {
 		return nil
 	}
+	err = _db.AutoMigrate(model.OwnerGeneration{})
+	if err != nil {
+		return nil
+	}
 	err = _db.AutoMigrate(model.Attributes{})
 	if err != nil {
 		return nil
@@ -89,6 +97,57 @@ func NewDB_MySQL(log *logrus.Logger, DBPath string) *DB {
 	if err != nil {
 		return nil
 	}
+	err = _db.AutoMigrate(model.ContractEvent{})
+	if err != nil {
+		return nil
+	}
+	err = _db.AutoMigrate(model.Price{})
+	if err != nil {
+		return nil
+	}
+	if _db.Migrator().HasIndex(&model.Subscription{}, "idx_subscription") {
+		// subscriptions were keyed by payer and token id only
+		err = _db.Migrator().DropIndex(&model.Subscription{}, "idx_subscription")
+		if err != nil {
+			return nil
+		}
+	}
+	err = _db.AutoMigrate(model.Subscription{})
+	if err != nil {
+		return nil
+	}
+	err = _db.AutoMigrate(model.WalletNonce{})
+	if err != nil {
+		return nil
+	}
+	err = _db.AutoMigrate(model.WalletProof{})
+	if err != nil {
+		return nil
+	}
+	err = _db.AutoMigrate(model.Identity{})
+	if err != nil {
+		return nil
+	}
+	err = _db.AutoMigrate(model.APIKey{})
+	if err != nil {
+		return nil
+	}
+	err = _db.AutoMigrate(model.PlayerWallet{})
+	if err != nil {
+		return nil
+	}
+	err = _db.AutoMigrate(model.WalletHistory{})
+	if err != nil {
+		return nil
+	}
+	err = seedPlayerWallets(_db)
+	if err != nil {
+		return nil
+	}
+	err = seedSubscriptions(_db)
+	if err != nil {
+		return nil
+	}
 
 	err = _db.AutoMigrate(model.FreebieEarnTotal{})
 	if err != nil {
@@ -107,3 +166,28 @@ func NewDB_MySQL(log *logrus.Logger, DBPath string) *DB {
 		DB:  _db,
 	}
 }
+
+// seedPlayerWallets fills an empty player_wallets table with the address of each player, which
+// was the only wallet a player could have.
+func seedPlayerWallets(db *gorm.DB) error {
+	var count int64
+	err := db.Model(&model.PlayerWallet{}).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return db.Exec("INSERT INTO player_wallets (user_id, address, chain_id, is_primary, created_at) " +
+		"SELECT user_id, eth_address, 0, true, NOW() FROM players WHERE eth_address IS NOT NULL").Error
+}
+
+// seedSubscriptions fills an empty subscriptions table from the latest expiry of each payer and
+// token in recharge_nfts, which held the expiry before subscriptions existed.
+func seedSubscriptions(db *gorm.DB) error {
+	var count int64
+	err := db.Model(&model.Subscription{}).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return db.Exec("INSERT INTO subscriptions (payer, chain_id, contract_address, token_id, expiry_date, created_at, updated_at) "+
+		"SELECT payer, MAX(chain_id), contract_address, token_id, MAX(expiry_date), NOW(), NOW() FROM recharge_nfts "+
+		"WHERE status = ? AND reject_reason = '' GROUP BY payer, contract_address, token_id", model.Confirmed).Error
+}
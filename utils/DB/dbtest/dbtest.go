@@ -0,0 +1,30 @@
+// Package dbtest opens throwaway databases for tests.
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open returns an in-memory sqlite database with the given tables migrated.
+func Open(t testing.TB, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would open its own in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(tables...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "math/big"
+
+// MAX_AMOUNT is the largest uint256, the range of on-chain token amounts.
+var MAX_AMOUNT = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// ParseAmount parses a token amount stored as a decimal string. It reports false unless the
+// amount is an integer in the uint256 range.
+func ParseAmount(amount string) (*big.Int, bool) {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok || value.Sign() < 0 || value.Cmp(MAX_AMOUNT) > 0 {
+		return nil, false
+	}
+	return value, true
+}
@@ -27,16 +27,65 @@ type configData struct {
 	NFTContractAddress     string `mapstructure:"nft_contract_address"`
 	TokenType              string `mapstructure:"token_type"`
 	WorkerPort             int    `mapstructure:"worker_port"`
+	WorkerHost             string `mapstructure:"worker_host"`
 	SyncBlockNumber        uint64 `mapstructure:"sync_block_number"`
 	Network                string `mapstructure:"network"`
 	PaymentContractAddress string `mapstructure:"payment_contract_address"`
 	SpecSchedule           string `mapstructure:"spec_schedule"`
 
+	// nft contracts, nft_contract_address/token_type/network describe a single one when empty
+	NFTContracts []NFTContract `mapstructure:"nft_contracts"`
+
+	// nft indexer
+	IndexerProvider  string `mapstructure:"indexer_provider"`
+	IndexerRPCURL    string `mapstructure:"indexer_rpc_url"`
+	IndexerFromBlock uint64 `mapstructure:"indexer_from_block"`
+	IndexerChainID   int64  `mapstructure:"indexer_chain_id"`
+	IndexerFilePath  string `mapstructure:"indexer_file_path"`
+
 	// nft expiry
 	NFTExpiryTime int `mapstructure:"nft_expiry_time"`
+
+	// auth: firebase, or dev to accept tokens minted with `sushi token` and the key pair in
+	// dev_auth_key_file instead
+	AuthMode       string `mapstructure:"auth_mode"`
+	DevAuthKeyFile string `mapstructure:"dev_auth_key_file"`
+
+	// firebase project ID tokens are issued for, the project of serviceAccountKey.json when empty
+	FirebaseProjectID string `mapstructure:"firebase_project_id"`
+
+	// OpenID Connect issuers whose ID tokens are accepted besides Firebase
+	OIDCProviders []OIDCProvider `mapstructure:"oidc_providers"`
+
+	// sign in with ethereum, the domain wallets sign for
+	SiweDomain string `mapstructure:"siwe_domain"`
+
+	// terms version players must accept to register, any when empty
+	TermsVersion string `mapstructure:"terms_version"`
+
+	// wallets, in seconds: how long an unlinked address is reserved for its player, and how long
+	// withdrawals to a new primary address are blocked
+	WalletUnlinkCooldown int `mapstructure:"wallet_unlink_cooldown"`
+	WalletWithdrawDelay  int `mapstructure:"wallet_withdraw_delay"`
 	//TxProcessorConfig TxProcessorConfig `mapstructure:"tx_processor_config"`
 }
 
+type NFTContract struct {
+	Address   string `mapstructure:"address"`
+	Chain     string `mapstructure:"chain"` // alchemy network, e.g. polygon-mainnet
+	ChainID   int64  `mapstructure:"chain_id"`
+	TokenType string `mapstructure:"token_type"`
+	RpcUrl    string `mapstructure:"rpc_url"`
+	FromBlock uint64 `mapstructure:"from_block"`
+}
+
+type OIDCProvider struct {
+	Name     string `mapstructure:"name"` // prefixes the sub of players created for the provider
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"` // client id the tokens are issued for
+	JWKSURL  string `mapstructure:"jwks_url"` // discovered from the issuer when empty
+}
+
 func NewConfig() (*Config, error) {
 
 	viper.SetConfigName("config") // name of config.yaml file (without extension)
@@ -100,6 +149,14 @@ func (c *Config) WorkerPort() int {
 	return c.config.WorkerPort
 }
 
+// WorkerHost is the address the unauthenticated worker control API listens on.
+func (c *Config) WorkerHost() string {
+	if c.config.WorkerHost == "" {
+		return "127.0.0.1" // default loopback only
+	}
+	return c.config.WorkerHost
+}
+
 func (c *Config) NFTExpiryTime() int {
 	if c.config.NFTExpiryTime == 0 {
 		return 10 * 24 * 60 * 60 //10 days (unix)
@@ -125,6 +182,106 @@ func (c *Config) TokenType() string {
 	return c.config.TokenType
 }
 
+// NFTContracts lists the tracked NFT contracts with defaults filled in from the single contract
+// settings (network, token_type, indexer_rpc_url, indexer_from_block, indexer_chain_id).
+func (c *Config) NFTContracts() []NFTContract {
+	contracts := c.config.NFTContracts
+	if len(contracts) == 0 {
+		if c.config.NFTContractAddress == "" {
+			return nil
+		}
+		contracts = []NFTContract{{Address: c.config.NFTContractAddress, TokenType: c.config.TokenType}}
+	}
+
+	result := make([]NFTContract, 0, len(contracts))
+	for _, contract := range contracts {
+		if contract.Chain == "" {
+			contract.Chain = c.Network()
+		}
+		if contract.TokenType != "ERC721" && contract.TokenType != "ERC1155" {
+			contract.TokenType = "ERC721" // default ERC721
+		}
+		if contract.RpcUrl == "" {
+			contract.RpcUrl = c.IndexerRPCURL()
+		}
+		if contract.FromBlock == 0 {
+			contract.FromBlock = c.IndexerFromBlock()
+		}
+		if contract.ChainID == 0 {
+			contract.ChainID = c.IndexerChainID()
+		}
+		result = append(result, contract)
+	}
+	return result
+}
+
+func (c *Config) IndexerProvider() string {
+	if c.config.IndexerProvider == "" {
+		return "alchemy"
+	}
+	return c.config.IndexerProvider
+}
+
+func (c *Config) IndexerRPCURL() string {
+	return c.config.IndexerRPCURL
+}
+
+func (c *Config) IndexerFromBlock() uint64 {
+	return c.config.IndexerFromBlock
+}
+
+func (c *Config) IndexerChainID() int64 {
+	return c.config.IndexerChainID
+}
+
+func (c *Config) IndexerFilePath() string {
+	return c.config.IndexerFilePath
+}
+
+func (c *Config) AuthMode() string {
+	if c.config.AuthMode != "dev" {
+		return "firebase" // default firebase
+	}
+	return c.config.AuthMode
+}
+
+func (c *Config) DevAuthKeyFile() string {
+	if c.config.DevAuthKeyFile == "" {
+		return "./dev_auth_key.pem"
+	}
+	return c.config.DevAuthKeyFile
+}
+
+func (c *Config) FirebaseProjectID() string {
+	return c.config.FirebaseProjectID
+}
+
+func (c *Config) OIDCProviders() []OIDCProvider {
+	return c.config.OIDCProviders
+}
+
+func (c *Config) TermsVersion() string {
+	return c.config.TermsVersion
+}
+
+func (c *Config) SiweDomain() string {
+	return c.config.SiweDomain
+}
+
+func (c *Config) WalletUnlinkCooldown() int {
+	if c.config.WalletUnlinkCooldown == 0 {
+		return 7 * 24 * 60 * 60 // 7 days
+	}
+	return c.config.WalletUnlinkCooldown
+}
+
+func (c *Config) WalletWithdrawDelay() int {
+	if c.config.WalletWithdrawDelay == 0 {
+		return 2 * 24 * 60 * 60 // 2 days
+	}
+	return c.config.WalletWithdrawDelay
+}
+
 func (c *Config) LogLevel() logrus.Level {
 	return c.config.LogLevel
 }
@@ -12,6 +12,28 @@ var SPEAK_NOT_ENOUGH_ERROR = errors.New("speak not enough")
 var SESSION_ID_EXIST_ERROR = errors.New("session id already exist")
 var UNVALUABLE_SESSION_ID_ERROR = errors.New("unvaluable session id")
 var ETH_ADDRESS_EXIST_ERROR = errors.New("eth address already exist")
+var ETH_ADDRESS_NOT_PROVEN_ERROR = errors.New("eth address not proven, sign in with ethereum first")
+var INVALID_SIWE_MESSAGE_ERROR = errors.New("invalid sign in with ethereum message")
+var INVALID_NONCE_ERROR = errors.New("invalid or expired nonce")
+var IDENTITY_EXIST_ERROR = errors.New("identity already linked to another player")
+var WALLET_NOT_FOUND_ERROR = errors.New("wallet not found")
+var WALLET_COOLDOWN_ERROR = errors.New("eth address was unlinked recently, try again later")
+var WITHDRAW_ADDRESS_LOCKED_ERROR = errors.New("withdrawals to a newly linked eth address are locked")
 var GET_USERINFO_ERROR = errors.New("get userinfo error")
 var PLAYER_ETH_ADDRESS_EXIST_ERROR = errors.New("user eth address already not exist")
 var FREE_BIE_USER_ERROR = errors.New("user is free bie")
+var JOB_NOT_FOUND_ERROR = errors.New("job not found")
+var JOB_RUNNING_ERROR = errors.New("job is already running")
+var JOB_PAUSED_ERROR = errors.New("job is paused")
+var OWNER_CURSOR_MOVED_ERROR = errors.New("owner transfer cursor moved")
+var NETWORK_NOT_FOUND_ERROR = errors.New("network not found")
+var NETWORK_EXIST_ERROR = errors.New("network already exist")
+var INVALID_NETWORK_ERROR = errors.New("invalid network")
+var PRICE_NOT_FOUND_ERROR = errors.New("price not found")
+var INVALID_PRICE_ERROR = errors.New("invalid price")
+var PERMISSION_DENIED_ERROR = errors.New("permission denied")
+var API_KEY_NOT_FOUND_ERROR = errors.New("api key not found")
+var INVALID_API_KEY_ERROR = errors.New("invalid api key")
+var INVALID_API_KEY_SCOPE_ERROR = errors.New("invalid api key scope")
+var WITHDRAW_PENDING_ERROR = errors.New("withdrawals are still pending")
+var TERMS_NOT_ACCEPTED_ERROR = errors.New("terms version not accepted")
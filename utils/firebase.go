@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -13,17 +12,24 @@ import (
 	"firebase.google.com/go/auth"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/api/option"
-	"io/ioutil"
-	"log"
+	"io"
 	"net/http"
-	"strings"
+	"os"
 	"time"
 )
 
+const (
+	FIREBASE_CREDENTIALS_FILE = "./serviceAccountKey.json"
+	FIREBASE_CERTS_URL        = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+	FIREBASE_ISSUER_PREFIX    = "https://securetoken.google.com/"
+)
+
 type Firebase struct {
 	Auth      *auth.Client
 	Firestore *firestore.Client
+	Verifier  *FirebaseVerifier
 }
 type CustomClaims struct {
 	Name     string `json:"name"`
@@ -36,96 +42,168 @@ type CustomClaims struct {
 	Iat      int64  `json:"iat"`
 	Exp      int64  `json:"exp"`
 	Email    string `json:"email"`
+	// roles set as custom claims with the admin SDK
+	Roles []string `json:"roles"`
 	jwt.StandardClaims
 }
 
-func NewFirebase(ctx context.Context) *Firebase {
-	opt := option.WithCredentialsFile("./serviceAccountKey.json")
-	app, err := firebase.NewApp(context.Background(), nil, opt)
+// NewFirebase connects to the admin APIs of the Firebase project with the credentials of
+// serviceAccountKey.json. The Verifier is left to StartFirebaseVerifier, it doesn't need them.
+func NewFirebase(ctx context.Context, projectID string) (*Firebase, error) {
+	opt := option.WithCredentialsFile(FIREBASE_CREDENTIALS_FILE)
+	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: projectID}, opt)
 	if err != nil {
-		fmt.Errorf("error initializing app: %v", err)
+		return nil, fmt.Errorf("error initializing app: %w", err)
 	}
 	auth, err := app.Auth(ctx)
 	if err != nil {
-		fmt.Errorf("error initializing app: %v", err)
+		return nil, fmt.Errorf("error initializing auth: %w", err)
 	}
 	firestore, err := app.Firestore(ctx)
 	if err != nil {
-		fmt.Errorf("error initializing app: %v", err)
+		return nil, fmt.Errorf("error initializing firestore: %w", err)
 	}
 	return &Firebase{
 		Auth:      auth,
 		Firestore: firestore,
-	}
+	}, nil
 }
 
-func VerifyFirebaseJWT(firebase *Firebase, ctx context.Context, tokenString string) error {
-	_, err := firebase.Auth.VerifyIDToken(ctx, tokenString)
-	if err != nil {
-		return err
+// StartFirebaseVerifier verifies the ID tokens of projectID, or of the project of
+// serviceAccountKey.json when it is empty, and refreshes Google's signing keys until ctx is done.
+func StartFirebaseVerifier(ctx context.Context, projectID string, log *logrus.Logger) (*FirebaseVerifier, error) {
+	if projectID == "" {
+		var err error
+		projectID, err = firebaseProjectID(FIREBASE_CREDENTIALS_FILE)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	verifier := NewFirebaseVerifier(projectID, NewHTTPKeySource(FIREBASE_CERTS_URL), log)
+	go verifier.Run(ctx)
+	return verifier, nil
 }
-func CheckFirebaseJWT(tokenString string) (CustomClaims, error) {
 
-	resp, err := http.Get("https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com")
+func firebaseProjectID(credentialsFile string) (string, error) {
+	data, err := os.ReadFile(credentialsFile)
 	if err != nil {
-		log.Fatalf("Failed to make a request: %v", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	var credentials struct {
+		ProjectID string `json:"project_id"`
+	}
+	err = json.Unmarshal(data, &credentials)
 	if err != nil {
-		log.Fatalf("Failed to read the response body: %v", err)
+		return "", fmt.Errorf("failed to parse %s: %w", credentialsFile, err)
+	}
+	if credentials.ProjectID == "" {
+		return "", fmt.Errorf("%s has no project_id", credentialsFile)
 	}
-	var result map[string]interface{}
-	err = json.Unmarshal([]byte(body), &result)
+	return credentials.ProjectID, nil
+}
+
+// HTTPKeySource reads x509 certificates keyed by key id from a URL, like Google publishes them.
+type HTTPKeySource struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPKeySource(url string) *HTTPKeySource {
+	return &HTTPKeySource{url: url, client: &http.Client{Timeout: KEYS_TIMEOUT}}
+}
 
+func (source *HTTPKeySource) FetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url, nil)
 	if err != nil {
-		log.Fatalf("Failed to json unmarshal: %v", err)
+		return nil, 0, err
 	}
-
-	parts := strings.Split(tokenString, ".")
-	// decode the header
-	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	resp, err := source.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to fetch keys: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error decoding JWT header:", err)
-		return CustomClaims{}, err
+		return nil, 0, fmt.Errorf("failed to read keys: %w", err)
 	}
-	var header map[string]interface{}
-	err = json.Unmarshal(headerJson, &header)
+	var certs map[string]string
+	err = json.Unmarshal(body, &certs)
 	if err != nil {
-		fmt.Printf("Error unmarshalling JWT header:", err)
-		return CustomClaims{}, err
+		return nil, 0, fmt.Errorf("failed to parse keys: %w", err)
 	}
-	kid := header["kid"].(string)
-	certString := result[kid].(string)
+
+	keys := make(map[string]*rsa.PublicKey, len(certs))
+	for kid, cert := range certs {
+		key, err := parseCertificateKey(cert)
+		if err != nil {
+			return nil, 0, fmt.Errorf("key %s: %w", kid, err)
+		}
+		keys[kid] = key
+	}
+	return keys, maxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+func parseCertificateKey(certString string) (*rsa.PublicKey, error) {
 	block, _ := pem.Decode([]byte(certString))
 	if block == nil {
-		fmt.Printf("failed to parse PEM block containing the public key")
-		return CustomClaims{}, err
+		return nil, errors.New("failed to parse PEM block containing the public key")
 	}
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		fmt.Printf("failed to parse certificate", err)
-		return CustomClaims{}, err
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate key is not RSA")
 	}
+	return key, nil
+}
+
+// FirebaseVerifier verifies Firebase ID tokens against cached signing keys.
+type FirebaseVerifier struct {
+	projectID string
+	keys      *KeyCache
+}
+
+func NewFirebaseVerifier(projectID string, source KeySource, log *logrus.Logger) *FirebaseVerifier {
+	return &FirebaseVerifier{projectID: projectID, keys: NewKeyCache(source, log)}
+}
+
+// Run refreshes the keys in the background until ctx is done.
+func (verifier *FirebaseVerifier) Run(ctx context.Context) {
+	verifier.keys.Run(ctx)
+}
 
-	rsaPublicKey := cert.PublicKey.(*rsa.PublicKey)
-	// 署名を検証
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return rsaPublicKey, nil
-	})
+// Issuer is the iss claim of the project's ID tokens.
+func (verifier *FirebaseVerifier) Issuer() string {
+	return FIREBASE_ISSUER_PREFIX + verifier.projectID
+}
+
+// Verify checks the signature of an ID token and that it was issued for the project, and
+// returns its claims.
+func (verifier *FirebaseVerifier) Verify(ctx context.Context, tokenString string) (CustomClaims, error) {
+	var claims CustomClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, verifier.keys.KeyFunc(ctx))
 	if err != nil {
-		return CustomClaims{}, errors.New("Token is not valid.")
+		return CustomClaims{}, fmt.Errorf("token is not valid: %w", err)
 	}
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		if time.Unix(claims.Exp, 0).Before(time.Now()) {
-			return CustomClaims{}, errors.New("Token is valid. But token is expired.")
-		} else {
-			return *claims, nil
-		}
-	} else {
-		return CustomClaims{}, errors.New("Token is not valid")
+
+	now := time.Now()
+	switch {
+	case claims.Aud != verifier.projectID:
+		return CustomClaims{}, errors.New("token has the wrong audience")
+	case claims.Iss != verifier.Issuer():
+		return CustomClaims{}, errors.New("token has the wrong issuer")
+	case claims.Sub == "":
+		return CustomClaims{}, errors.New("token has no subject")
+	case !time.Unix(claims.Exp, 0).After(now):
+		return CustomClaims{}, errors.New("token is expired")
+	case time.Unix(claims.Iat, 0).After(now.Add(CLOCK_SKEW)),
+		time.Unix(claims.AuthTime, 0).After(now.Add(CLOCK_SKEW)):
+		return CustomClaims{}, errors.New("token is issued in the future")
 	}
+	return claims, nil
 }
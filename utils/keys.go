@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	KEYS_DEFAULT_MAX_AGE = 1 * time.Hour    // when the response has no max-age
+	KEYS_REFRESH_MARGIN  = 5 * time.Minute  // refresh this long before the keys expire
+	KEYS_RETRY           = 30 * time.Second // after a failed fetch, doubled for each further failure
+	KEYS_MAX_RETRY       = 10 * time.Minute // longest wait between failed fetches
+	KEYS_MIN_REFRESH     = 1 * time.Minute  // between fetches caused by unknown key ids
+	KEYS_TIMEOUT         = 10 * time.Second
+	CLOCK_SKEW           = 1 * time.Minute
+)
+
+// KeySource provides the public keys tokens are signed with, by key id, and how long they may
+// be cached.
+type KeySource interface {
+	FetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error)
+}
+
+// StaticKeySource serves fixed keys that never expire, to verify tokens offline.
+type StaticKeySource map[string]*rsa.PublicKey
+
+func (source StaticKeySource) FetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	return source, 0, nil
+}
+
+// maxAge reads max-age from a Cache-Control header.
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return KEYS_DEFAULT_MAX_AGE
+}
+
+// KeyCache caches the keys of a KeySource. Requests only wait for the source when the cache is
+// empty or expired, or a token has an unknown key id, and at most once per KEYS_MIN_REFRESH, or
+// per retry interval while the source fails. Expired keys are served until a fetch succeeds.
+type KeyCache struct {
+	source KeySource
+	log    *logrus.Logger
+	now    func() time.Time
+
+	fetching sync.Mutex // held while the source is asked, so one fetch runs at a time
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	expiry    time.Time // zero when the keys never expire
+	attempted time.Time // last fetch, failed or not
+	failures  int       // fetches failed in a row
+	fetches   int       // fetches done
+	err       error     // of the last fetch
+}
+
+func NewKeyCache(source KeySource, log *logrus.Logger) *KeyCache {
+	return &KeyCache{source: source, log: log, now: time.Now}
+}
+
+// Run refreshes the keys shortly before they expire until ctx is done.
+func (cache *KeyCache) Run(ctx context.Context) {
+	for {
+		cache.mu.RLock()
+		fetches := cache.fetches
+		cache.mu.RUnlock()
+		err := cache.refresh(ctx, fetches)
+		cache.mu.RLock()
+		wait := cache.retryAfter()
+		expiry := cache.expiry
+		cache.mu.RUnlock()
+		if err != nil {
+			if cache.log != nil {
+				cache.log.Error("failed to refresh signing keys: ", err)
+			}
+		} else {
+			if expiry.IsZero() {
+				return
+			}
+			if until := expiry.Sub(cache.now()) - KEYS_REFRESH_MARGIN; until > wait {
+				wait = until
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryAfter is how long after the last fetch the source may be asked again. The caller holds
+// cache.mu.
+func (cache *KeyCache) retryAfter() time.Duration {
+	if cache.failures == 0 {
+		return KEYS_MIN_REFRESH
+	}
+	wait := KEYS_RETRY
+	for i := 1; i < cache.failures && wait < KEYS_MAX_RETRY; i++ {
+		wait *= 2
+	}
+	if wait > KEYS_MAX_RETRY {
+		return KEYS_MAX_RETRY
+	}
+	return wait
+}
+
+// refresh fetches the keys, unless a fetch finished since the caller saw fetches, whose result
+// is shared instead. Requests missing the cache together wait for a single fetch.
+func (cache *KeyCache) refresh(ctx context.Context, fetches int) error {
+	cache.fetching.Lock()
+	defer cache.fetching.Unlock()
+	cache.mu.RLock()
+	done, err := cache.fetches != fetches, cache.err
+	cache.mu.RUnlock()
+	if done {
+		return err
+	}
+
+	keys, maxAge, err := cache.source.FetchKeys(ctx)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	now := cache.now()
+	cache.attempted = now
+	cache.fetches++
+	cache.err = err
+	if err != nil {
+		cache.failures++
+		return err
+	}
+	cache.failures = 0
+	cache.keys = keys
+	cache.expiry = time.Time{}
+	if maxAge > 0 {
+		cache.expiry = now.Add(maxAge)
+	}
+	return nil
+}
+
+// Key returns the key of kid, fetching the keys again if they expired or kid is unknown. A key
+// that expired is still returned while the source can't be reached.
+func (cache *KeyCache) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	cache.mu.RLock()
+	now := cache.now()
+	key, ok := cache.keys[kid]
+	fresh := cache.keys != nil && (cache.expiry.IsZero() || now.Before(cache.expiry))
+	recent := !cache.attempted.IsZero() && now.Sub(cache.attempted) < cache.retryAfter()
+	empty := cache.keys == nil
+	fetches := cache.fetches
+	cache.mu.RUnlock()
+	if ok && (fresh || recent) {
+		return key, nil
+	}
+	if recent {
+		// keys rotate rarely, don't let made up key ids or a failing source hold up every request
+		if empty {
+			return nil, errors.New("signing keys are not available")
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	err := cache.refresh(ctx, fetches)
+	if err != nil {
+		if ok {
+			if cache.log != nil {
+				cache.log.Warn("failed to refresh signing keys, serving expired keys: ", err)
+			}
+			return key, nil
+		}
+		return nil, err
+	}
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	key, ok = cache.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// KeyFunc looks up the key of an RS256 token by its kid header.
+func (cache *KeyCache) KeyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no key id")
+		}
+		return cache.Key(ctx, kid)
+	}
+}
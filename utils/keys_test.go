@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeKeySource serves keys set by the test, or fails with err.
+type fakeKeySource struct {
+	keys   map[string]*rsa.PublicKey
+	maxAge time.Duration
+	err    error
+	calls  int
+}
+
+func (source *fakeKeySource) FetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	source.calls++
+	if source.err != nil {
+		return nil, 0, source.err
+	}
+	return source.keys, source.maxAge, nil
+}
+
+// fakeClock is a clock that only moves when the test advances it.
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.now = clock.now.Add(d)
+}
+
+// blockingKeySource serves keys once release is closed, signalling started on its first call.
+type blockingKeySource struct {
+	keys    map[string]*rsa.PublicKey
+	started chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (source *blockingKeySource) FetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	if source.calls.Add(1) == 1 {
+		close(source.started)
+	}
+	<-source.release
+	return source.keys, time.Hour, nil
+}
+
+func newTestKeyCache(source KeySource) (*KeyCache, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache := NewKeyCache(source, nil)
+	cache.now = clock.Now
+	return cache, clock
+}
+
+func TestKeyCacheRotation(t *testing.T) {
+	oldKey := &testKey(t).PublicKey
+	newKey := &testKey(t).PublicKey
+	source := &fakeKeySource{keys: map[string]*rsa.PublicKey{"old": oldKey}, maxAge: time.Hour}
+	cache, clock := newTestKeyCache(source)
+	ctx := context.Background()
+
+	key, err := cache.Key(ctx, "old")
+	if err != nil || key != oldKey {
+		t.Fatalf("Key(old) = %v, %v", key, err)
+	}
+
+	// the source rotates, the new key id is fetched at most once per KEYS_MIN_REFRESH
+	source.keys = map[string]*rsa.PublicKey{"new": newKey}
+	_, err = cache.Key(ctx, "new")
+	if err == nil {
+		t.Fatal("Key(new) fetched again right after the last fetch")
+	}
+	if source.calls != 1 {
+		t.Fatalf("source called %d times, want 1", source.calls)
+	}
+	clock.Advance(KEYS_MIN_REFRESH)
+	key, err = cache.Key(ctx, "new")
+	if err != nil || key != newKey {
+		t.Fatalf("Key(new) = %v, %v after rotation", key, err)
+	}
+	_, err = cache.Key(ctx, "old")
+	if err == nil {
+		t.Fatal("Key(old) still served after rotation")
+	}
+	if source.calls != 2 {
+		t.Fatalf("source called %d times, want 2", source.calls)
+	}
+}
+
+func TestKeyCacheConcurrentMisses(t *testing.T) {
+	key := &testKey(t).PublicKey
+	source := &blockingKeySource{
+		keys:    map[string]*rsa.PublicKey{"key": key},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	cache, _ := newTestKeyCache(source)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cache.Key(context.Background(), "key")
+			if err == nil && got != key {
+				err = errors.New("wrong key")
+			}
+			errs <- err
+		}()
+	}
+	<-source.started
+	// let the other requests miss the cache while the first fetch is running
+	time.Sleep(50 * time.Millisecond)
+	close(source.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Key() error = %v", err)
+		}
+	}
+	if calls := source.calls.Load(); calls != 1 {
+		t.Fatalf("source called %d times, want 1", calls)
+	}
+}
+
+func TestKeyCacheExpiredKeysWhileSourceFails(t *testing.T) {
+	key := &testKey(t).PublicKey
+	source := &fakeKeySource{keys: map[string]*rsa.PublicKey{"key": key}, maxAge: time.Hour}
+	cache, clock := newTestKeyCache(source)
+	ctx := context.Background()
+
+	_, err := cache.Key(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source.err = errors.New("source is down")
+	clock.Advance(2 * time.Hour)
+	got, err := cache.Key(ctx, "key")
+	if err != nil || got != key {
+		t.Fatalf("Key() = %v, %v, want the expired key", got, err)
+	}
+	if source.calls != 2 {
+		t.Fatalf("source called %d times, want 2", source.calls)
+	}
+
+	// no request waits for the source again before the retry interval, which doubles with each
+	// failure up to KEYS_MAX_RETRY
+	waits := []time.Duration{KEYS_RETRY, 2 * KEYS_RETRY, 4 * KEYS_RETRY, 8 * KEYS_RETRY, 16 * KEYS_RETRY, KEYS_MAX_RETRY, KEYS_MAX_RETRY}
+	for i, wait := range waits {
+		calls := source.calls
+		clock.Advance(wait - time.Second)
+		got, err = cache.Key(ctx, "key")
+		if err != nil || got != key {
+			t.Fatalf("failure %d: Key() = %v, %v, want the expired key", i+1, got, err)
+		}
+		if source.calls != calls {
+			t.Fatalf("failure %d: source called before %s", i+1, wait)
+		}
+		clock.Advance(time.Second)
+		_, err = cache.Key(ctx, "key")
+		if err != nil {
+			t.Fatalf("failure %d: Key() error = %v", i+1, err)
+		}
+		if source.calls != calls+1 {
+			t.Fatalf("failure %d: source not called after %s", i+1, wait)
+		}
+	}
+
+	// a successful fetch ends the backoff
+	source.err = nil
+	clock.Advance(KEYS_MAX_RETRY)
+	_, err = cache.Key(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.mu.RLock()
+	failures, expiry := cache.failures, cache.expiry
+	cache.mu.RUnlock()
+	if failures != 0 || !expiry.After(clock.Now()) {
+		t.Fatalf("failures = %d, expiry = %s after a successful fetch", failures, expiry)
+	}
+}
+
+func TestKeyCacheEmptyWhileSourceFails(t *testing.T) {
+	source := &fakeKeySource{err: errors.New("source is down")}
+	cache, clock := newTestKeyCache(source)
+	ctx := context.Background()
+
+	_, err := cache.Key(ctx, "key")
+	if err == nil {
+		t.Fatal("Key() without keys succeeded")
+	}
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Second)
+		_, err = cache.Key(ctx, "key")
+		if err == nil {
+			t.Fatal("Key() without keys succeeded")
+		}
+	}
+	if source.calls != 1 {
+		t.Fatalf("source called %d times within KEYS_RETRY, want 1", source.calls)
+	}
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+const OIDC_DISCOVERY_PATH = "/.well-known/openid-configuration"
+
+// JWKSKeySource reads the RSA keys of a JSON Web Key Set. Without a URL it is discovered from
+// the OpenID configuration of the issuer.
+type JWKSKeySource struct {
+	issuer string
+	url    string
+	client *http.Client
+}
+
+func NewJWKSKeySource(issuer string, url string) *JWKSKeySource {
+	return &JWKSKeySource{issuer: issuer, url: url, client: &http.Client{Timeout: KEYS_TIMEOUT}}
+}
+
+func (source *JWKSKeySource) FetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	url := source.url
+	if url == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		_, err := source.getJSON(ctx, strings.TrimSuffix(source.issuer, "/")+OIDC_DISCOVERY_PATH, &discovery)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to discover keys: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, 0, errors.New("openid configuration has no jwks_uri")
+		}
+		url = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	header, err := source.getJSON(ctx, url, &jwks)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, 0, fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, 0, fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, maxAge(header.Get("Cache-Control")), nil
+}
+
+func (source *JWKSKeySource) getJSON(ctx context.Context, url string, value interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := source.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(value)
+}
+
+// OIDCClaims are the claims of an OpenID Connect ID token the API uses.
+type OIDCClaims struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+	Roles   []string
+}
+
+// OIDCVerifier verifies RS256 ID tokens of an OpenID Connect issuer for an audience.
+type OIDCVerifier struct {
+	issuer   string
+	audience string
+	keys     *KeyCache
+}
+
+func NewOIDCVerifier(issuer string, audience string, source KeySource, log *logrus.Logger) *OIDCVerifier {
+	return &OIDCVerifier{issuer: issuer, audience: audience, keys: NewKeyCache(source, log)}
+}
+
+// Run refreshes the keys in the background until ctx is done.
+func (verifier *OIDCVerifier) Run(ctx context.Context) {
+	verifier.keys.Run(ctx)
+}
+
+func (verifier *OIDCVerifier) Issuer() string {
+	return verifier.issuer
+}
+
+func (verifier *OIDCVerifier) Verify(ctx context.Context, tokenString string) (OIDCClaims, error) {
+	claims := jwt.MapClaims{}
+	// MapClaims checks exp, iat and nbf when present
+	_, err := jwt.ParseWithClaims(tokenString, claims, verifier.keys.KeyFunc(ctx))
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("token is not valid: %w", err)
+	}
+
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	switch {
+	case issuer != verifier.issuer:
+		return OIDCClaims{}, errors.New("token has the wrong issuer")
+	case !hasAudience(claims["aud"], verifier.audience):
+		return OIDCClaims{}, errors.New("token has the wrong audience")
+	case subject == "":
+		return OIDCClaims{}, errors.New("token has no subject")
+	case claims["exp"] == nil:
+		return OIDCClaims{}, errors.New("token has no expiry")
+	}
+	return OIDCClaims{Issuer: issuer, Subject: subject, Email: email, Name: name, Roles: rolesClaim(claims["roles"])}, nil
+}
+
+// hasAudience reports whether an aud claim, a string or a list of them, contains audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TokenIssuer returns the iss claim of a token without verifying it, to pick its verifier.
+func TokenIssuer(tokenString string) (string, error) {
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims)
+	if err != nil {
+		return "", fmt.Errorf("token is not valid: %w", err)
+	}
+	issuer, _ := claims["iss"].(string)
+	if issuer == "" {
+		return "", errors.New("token has no issuer")
+	}
+	return issuer, nil
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testIssuer   = "https://login.example.com"
+	testAudience = "sushi"
+	testKeyID    = "key-1"
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "alice",
+		"email": "alice@example.com",
+		"roles": []string{ROLE_ADMIN, "root"},
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestOIDCVerifierVerify(t *testing.T) {
+	key := testKey(t)
+	otherKey := testKey(t)
+	verifier := NewOIDCVerifier(testIssuer, testAudience, StaticKeySource{testKeyID: &key.PublicKey}, nil)
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", signToken(t, jwt.SigningMethodRS256, key, testKeyID, validClaims()), true},
+		{"audience list", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("aud", []string{"other", testAudience})), true},
+		{"wrong signature", signToken(t, jwt.SigningMethodRS256, otherKey, testKeyID, validClaims()), false},
+		{"unknown key id", signToken(t, jwt.SigningMethodRS256, key, "key-2", validClaims()), false},
+		{"no key id", signToken(t, jwt.SigningMethodRS256, key, "", validClaims()), false},
+		{"hmac", signToken(t, jwt.SigningMethodHS256, []byte("secret"), testKeyID, validClaims()), false},
+		{"wrong issuer", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("iss", "https://evil.example.com")), false},
+		{"wrong audience", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("aud", "other")), false},
+		{"no audience", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("aud", nil)), false},
+		{"expired", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"no expiry", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("exp", nil)), false},
+		{"not yet valid", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("nbf", time.Now().Add(time.Hour).Unix())), false},
+		{"no subject", signToken(t, jwt.SigningMethodRS256, key, testKeyID, with("sub", nil)), false},
+		{"garbage", "not.a.token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), test.token)
+			if test.valid && err != nil {
+				t.Fatalf("Verify() error = %v, want none", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatalf("Verify() accepted the token")
+			}
+			if test.valid && (claims.Subject != "alice" || claims.Issuer != testIssuer) {
+				t.Fatalf("Verify() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifierRoles(t *testing.T) {
+	key := testKey(t)
+	verifier := NewOIDCVerifier(testIssuer, testAudience, StaticKeySource{testKeyID: &key.PublicKey}, nil)
+	claims, err := verifier.Verify(context.Background(), signToken(t, jwt.SigningMethodRS256, key, testKeyID, validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != ROLE_ADMIN {
+		t.Fatalf("Roles = %v, want only the known role %q", claims.Roles, ROLE_ADMIN)
+	}
+}
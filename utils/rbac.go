@@ -0,0 +1,94 @@
+package utils
+
+// Roles are granted through the "roles" claim of a token, a list of role names. Every signed in
+// account is a player.
+const (
+	ROLE_PLAYER      = "player"
+	ROLE_SUPPORT     = "support"
+	ROLE_FINANCE     = "finance"
+	ROLE_ADMIN       = "admin"
+	ROLE_GAME_SERVER = "game-server"
+	ROLE_TX_SERVER   = "tx-server"
+)
+
+const (
+	PERMISSION_PLAY           = "play"
+	PERMISSION_NETWORKS_READ  = "networks:read"
+	PERMISSION_NETWORKS_WRITE = "networks:write"
+	PERMISSION_PRICES_WRITE   = "prices:write"
+	PERMISSION_EARN           = "earn"
+	PERMISSION_WITHDRAW       = "withdraw"
+	PERMISSION_API_KEYS       = "api-keys"
+)
+
+// Scopes are granted to API keys, for machine clients.
+const (
+	SCOPE_EARN             = "earn"
+	SCOPE_WITHDRAW_PROCESS = "withdraw-process"
+	SCOPE_READ_ONLY        = "read-only"
+)
+
+var ROLE_PERMISSIONS = map[string][]string{
+	ROLE_PLAYER:      {PERMISSION_PLAY},
+	ROLE_SUPPORT:     {PERMISSION_NETWORKS_READ},
+	ROLE_FINANCE:     {PERMISSION_NETWORKS_READ, PERMISSION_PRICES_WRITE},
+	ROLE_ADMIN:       {PERMISSION_NETWORKS_READ, PERMISSION_NETWORKS_WRITE, PERMISSION_PRICES_WRITE, PERMISSION_API_KEYS},
+	ROLE_GAME_SERVER: {PERMISSION_EARN},
+	ROLE_TX_SERVER:   {PERMISSION_WITHDRAW},
+}
+
+var SCOPE_PERMISSIONS = map[string][]string{
+	SCOPE_EARN:             {PERMISSION_EARN},
+	SCOPE_WITHDRAW_PROCESS: {PERMISSION_WITHDRAW},
+	SCOPE_READ_ONLY:        {PERMISSION_NETWORKS_READ},
+}
+
+func IsRole(role string) bool {
+	_, ok := ROLE_PERMISSIONS[role]
+	return ok
+}
+
+func IsScope(scope string) bool {
+	_, ok := SCOPE_PERMISSIONS[scope]
+	return ok
+}
+
+// RolePermissions returns the permissions granted by roles.
+func RolePermissions(roles []string) []string {
+	return grantedPermissions(ROLE_PERMISSIONS, roles)
+}
+
+// ScopePermissions returns the permissions granted by the scopes of an API key.
+func ScopePermissions(scopes []string) []string {
+	return grantedPermissions(SCOPE_PERMISSIONS, scopes)
+}
+
+func grantedPermissions(grants map[string][]string, names []string) []string {
+	var permissions []string
+	for _, name := range names {
+		permissions = append(permissions, grants[name]...)
+	}
+	return permissions
+}
+
+func HasPermission(permissions []string, permission string) bool {
+	for _, granted := range permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// rolesClaim reads the roles of a "roles" claim, dropping the ones that aren't known.
+func rolesClaim(claim interface{}) []string {
+	values, _ := claim.([]interface{})
+	var roles []string
+	for _, value := range values {
+		role, _ := value.(string)
+		if IsRole(role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const SIWE_HEADER_SUFFIX = " wants you to sign in with your Ethereum account:"
+
+// SiweMessage is a Sign-In With Ethereum message (EIP-4361).
+type SiweMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseSiweMessage parses the text of an EIP-4361 message.
+func ParseSiweMessage(text string) (*SiweMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], SIWE_HEADER_SUFFIX) {
+		return nil, errors.New("missing sign in header")
+	}
+	var message SiweMessage
+	message.Domain = strings.TrimSuffix(lines[0], SIWE_HEADER_SUFFIX)
+	if message.Domain == "" {
+		return nil, errors.New("missing domain")
+	}
+	if !common.IsHexAddress(lines[1]) || !strings.HasPrefix(lines[1], "0x") {
+		return nil, fmt.Errorf("invalid address %q", lines[1])
+	}
+	message.Address = common.HexToAddress(lines[1])
+
+	// an empty line, then an optional statement followed by another empty line
+	i := 2
+	if i >= len(lines) || lines[i] != "" {
+		return nil, errors.New("missing empty line after address")
+	}
+	i++
+	if i < len(lines) && !strings.HasPrefix(lines[i], "URI: ") {
+		message.Statement = lines[i]
+		i++
+		if i >= len(lines) || lines[i] != "" {
+			return nil, errors.New("missing empty line after statement")
+		}
+		i++
+	}
+
+	fields := make(map[string]string)
+	for ; i < len(lines); i++ {
+		if lines[i] == "Resources:" {
+			for i++; i < len(lines); i++ {
+				if !strings.HasPrefix(lines[i], "- ") {
+					return nil, fmt.Errorf("invalid resource %q", lines[i])
+				}
+				message.Resources = append(message.Resources, strings.TrimPrefix(lines[i], "- "))
+			}
+			break
+		}
+		key, value, ok := strings.Cut(lines[i], ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q", lines[i])
+		}
+		fields[key] = value
+	}
+
+	var err error
+	message.URI = fields["URI"]
+	message.Version = fields["Version"]
+	message.Nonce = fields["Nonce"]
+	message.RequestID = fields["Request ID"]
+	if message.URI == "" || message.Version == "" || message.Nonce == "" {
+		return nil, errors.New("missing URI, Version or Nonce")
+	}
+	message.ChainID, err = strconv.ParseInt(fields["Chain ID"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain id: %w", err)
+	}
+	message.IssuedAt, err = time.Parse(time.RFC3339, fields["Issued At"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid issued at: %w", err)
+	}
+	if value, ok := fields["Expiration Time"]; ok {
+		expirationTime, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiration time: %w", err)
+		}
+		message.ExpirationTime = &expirationTime
+	}
+	if value, ok := fields["Not Before"]; ok {
+		notBefore, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid not before: %w", err)
+		}
+		message.NotBefore = &notBefore
+	}
+	return &message, nil
+}
+
+// Verify checks that the message was issued for domain in the supported version and is valid
+// at now. An empty domain accepts none.
+func (message *SiweMessage) Verify(domain string, now time.Time) error {
+	if domain == "" || message.Domain != domain {
+		return fmt.Errorf("domain %q is not accepted", message.Domain)
+	}
+	if message.Version != "1" {
+		return fmt.Errorf("version %q is not supported", message.Version)
+	}
+	return message.Valid(now)
+}
+
+// Valid checks the validity period of the message at now.
+func (message *SiweMessage) Valid(now time.Time) error {
+	if message.ExpirationTime != nil && !now.Before(*message.ExpirationTime) {
+		return errors.New("message expired")
+	}
+	if message.NotBefore != nil && now.Before(*message.NotBefore) {
+		return errors.New("message not valid yet")
+	}
+	return nil
+}
+
+// RecoverSiweSigner returns the address that signed text with personal_sign.
+func RecoverSiweSigner(text string, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, errors.New("invalid signature length")
+	}
+	// wallets return v as 27 or 28
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(text)), sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var siweNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+const siweAddress = "0x71C7656EC7ab88b098defB751B7401B5f6d8976F"
+
+func siweText(lines ...string) string {
+	return strings.Join(lines, "\n")
+}
+
+func validSiweText(address string) string {
+	return siweText(
+		"app.example.com wants you to sign in with your Ethereum account:",
+		address,
+		"",
+		"Link this wallet to your player.",
+		"",
+		"URI: https://app.example.com",
+		"Version: 1",
+		"Chain ID: 137",
+		"Nonce: 0123456789abcdef",
+		"Issued At: 2024-05-01T11:59:00Z",
+		"Expiration Time: 2024-05-01T12:10:00Z",
+	)
+}
+
+func TestParseSiweMessage(t *testing.T) {
+	message, err := ParseSiweMessage(validSiweText(siweAddress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Domain != "app.example.com" || message.Address.Hex() != siweAddress || message.ChainID != 137 ||
+		message.Nonce != "0123456789abcdef" || message.Statement != "Link this wallet to your player." || message.ExpirationTime == nil {
+		t.Fatalf("ParseSiweMessage() = %+v", message)
+	}
+
+	withoutStatement := siweText(
+		"app.example.com wants you to sign in with your Ethereum account:",
+		siweAddress,
+		"",
+		"URI: https://app.example.com",
+		"Version: 1",
+		"Chain ID: 1",
+		"Nonce: abc",
+		"Issued At: 2024-05-01T11:59:00Z",
+		"Resources:",
+		"- https://app.example.com/terms",
+	)
+	message, err = ParseSiweMessage(strings.ReplaceAll(withoutStatement, "\n", "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Statement != "" || len(message.Resources) != 1 {
+		t.Fatalf("ParseSiweMessage() = %+v", message)
+	}
+}
+
+func TestParseSiweMessageMalformed(t *testing.T) {
+	valid := strings.Split(validSiweText(siweAddress), "\n")
+	replace := func(i int, line string) string {
+		lines := append([]string(nil), valid...)
+		lines[i] = line
+		return siweText(lines...)
+	}
+	remove := func(i int) string {
+		lines := append([]string(nil), valid[:i]...)
+		return siweText(append(lines, valid[i+1:]...)...)
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"no header", replace(0, "app.example.com wants you to sign in")},
+		{"no domain", replace(0, SIWE_HEADER_SUFFIX)},
+		{"address without 0x", replace(1, strings.TrimPrefix(siweAddress, "0x"))},
+		{"invalid address", replace(1, "0x1234")},
+		{"no empty line after address", remove(2)},
+		{"no empty line after statement", remove(4)},
+		{"invalid line", replace(6, "Version 1")},
+		{"no URI", remove(5)},
+		{"no version", remove(6)},
+		{"no nonce", remove(8)},
+		{"invalid chain id", replace(7, "Chain ID: polygon")},
+		{"invalid issued at", replace(9, "Issued At: yesterday")},
+		{"invalid expiration time", replace(10, "Expiration Time: 2024-05-01")},
+		{"invalid resource", validSiweText(siweAddress) + "\nResources:\nhttps://app.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseSiweMessage(test.text)
+			if err == nil {
+				t.Fatalf("ParseSiweMessage() accepted %q", test.text)
+			}
+		})
+	}
+}
+
+func TestSiweMessageVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		domain string
+		now    time.Time
+		valid  bool
+	}{
+		{"valid", validSiweText(siweAddress), "app.example.com", siweNow, true},
+		{"wrong domain", validSiweText(siweAddress), "evil.example.com", siweNow, false},
+		{"no domain configured", validSiweText(siweAddress), "", siweNow, false},
+		{"wrong version", strings.Replace(validSiweText(siweAddress), "Version: 1", "Version: 2", 1), "app.example.com", siweNow, false},
+		{"expired", validSiweText(siweAddress), "app.example.com", siweNow.Add(10 * time.Minute), false},
+		{"not valid yet", validSiweText(siweAddress) + "\nNot Before: 2024-05-01T12:05:00Z", "app.example.com", siweNow, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := ParseSiweMessage(test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = message.Verify(test.domain, test.now)
+			if test.valid && err != nil {
+				t.Fatalf("Verify() error = %v, want none", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("Verify() accepted the message")
+			}
+		})
+	}
+}
+
+func TestRecoverSiweSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	text := validSiweText(address.Hex())
+	sign := func(text string, key *ecdsa.PrivateKey) string {
+		sig, err := crypto.Sign(accounts.TextHash([]byte(text)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[crypto.RecoveryIDOffset] += 27
+		return hexutil.Encode(sig)
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		valid     bool
+	}{
+		{"signer", sign(text, key), true},
+		{"wrong signer", sign(text, otherKey), false},
+		{"other message", sign(validSiweText(siweAddress), key), false},
+		{"not hex", "signature", false},
+		{"short", sign(text, key)[:100], false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := RecoverSiweSigner(text, test.signature)
+			if test.valid && (err != nil || signer != address) {
+				t.Fatalf("RecoverSiweSigner() = %s, %v, want %s", signer.Hex(), err, address.Hex())
+			}
+			if !test.valid && err == nil && signer == address {
+				t.Fatalf("RecoverSiweSigner() = %s", signer.Hex())
+			}
+		})
+	}
+}
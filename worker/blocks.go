@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	BLOCK_TIMESTAMP_CACHE_SIZE = 4096 // block timestamps kept per network
+	HEADER_BATCH_SIZE          = 100  // headers per batched RPC call
+)
+
+// blockTimestamp returns the timestamp of a block, reading only its header on a cache miss.
+func (crawler *Crawler) blockTimestamp(ctx context.Context, blockNumber uint64) (uint64, error) {
+	if timestamp, ok := crawler.timestamps.Get(blockNumber); ok {
+		return timestamp, nil
+	}
+	header, err := crawler.client.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return 0, err
+	}
+	crawler.timestamps.Add(blockNumber, header.Time)
+	return header.Time, nil
+}
+
+// prefetchTimestamps loads the timestamps of the blocks holding handled logs in batched RPC
+// calls, so a backfill range costs a few requests instead of one per log.
+func (crawler *Crawler) prefetchTimestamps(ctx context.Context, logs []types.Log) error {
+	var missing []uint64
+	seen := make(map[uint64]bool)
+	for _, log := range logs {
+		if !crawler.handles(log) || seen[log.BlockNumber] {
+			continue
+		}
+		seen[log.BlockNumber] = true
+		if !crawler.timestamps.Contains(log.BlockNumber) {
+			missing = append(missing, log.BlockNumber)
+		}
+	}
+
+	for start := 0; start < len(missing); start += HEADER_BATCH_SIZE {
+		end := start + HEADER_BATCH_SIZE
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := make([]rpc.BatchElem, 0, end-start)
+		headers := make([]*types.Header, end-start)
+		for i, blockNumber := range missing[start:end] {
+			batch = append(batch, rpc.BatchElem{
+				Method: "eth_getBlockByNumber",
+				Args:   []interface{}{hexutil.EncodeUint64(blockNumber), false},
+				Result: &headers[i],
+			})
+		}
+		err := crawler.client.Client().BatchCallContext(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return fmt.Errorf("block %d: %w", missing[start+i], elem.Error)
+			}
+			if headers[i] == nil {
+				return fmt.Errorf("block %d not found", missing[start+i])
+			}
+			crawler.timestamps.Add(missing[start+i], headers[i].Time)
+		}
+	}
+	return nil
+}
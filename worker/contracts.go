@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"strings"
+	"sushi/model"
+	"sushi/utils/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+// seedContracts marks the configured NFT contracts as tracked, creating their contract rows if
+// needed, and stops tracking contracts removed from the config. Rows written before contracts
+// were told apart are attached to the contract of nft_contract_address.
+func (handler *Handler) seedContracts() error {
+	return handler.db.DB.Transaction(func(tx *gorm.DB) error {
+		var tracked []uint64
+		for _, nftContract := range handler.conf.NFTContracts() {
+			var contract model.Contract
+			err := tx.Where("lower(address) = ?", strings.ToLower(nftContract.Address)).
+				Attrs(model.Contract{Address: nftContract.Address}).
+				FirstOrCreate(&contract).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&contract).Select("tracked", "chain", "chain_id", "token_type", "rpc_url", "from_block").Updates(model.Contract{
+				Tracked:   true,
+				Chain:     nftContract.Chain,
+				ChainID:   nftContract.ChainID,
+				TokenType: nftContract.TokenType,
+				RpcUrl:    nftContract.RpcUrl,
+				FromBlock: nftContract.FromBlock,
+			}).Error
+			if err != nil {
+				return err
+			}
+			tracked = append(tracked, contract.ContractID)
+
+			if strings.EqualFold(nftContract.Address, handler.conf.NFTContractAddress()) {
+				err = handler.adoptLegacyRows(tx, contract.ContractID, nftContract)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		untracked := tx.Model(&model.Contract{}).Where("tracked = ?", true)
+		if len(tracked) > 0 {
+			untracked = untracked.Where("contract_id NOT IN ?", tracked)
+		}
+		return untracked.Update("tracked", false).Error
+	})
+}
+
+func (handler *Handler) adoptLegacyRows(tx *gorm.DB, contractID uint64, nftContract config.NFTContract) error {
+	for _, table := range []interface{}{&model.Owner{}, &model.NFTImage{}, &model.Attributes{}} {
+		err := tx.Model(table).Where("contract_id = 0 AND token_type = ?", nftContract.TokenType).Update("contract_id", contractID).Error
+		if err != nil {
+			return err
+		}
+	}
+	// payments on every network unlocked tokens of this contract
+	for _, table := range []interface{}{&model.RechargeNFT{}, &model.Subscription{}} {
+		err := tx.Model(table).Where("contract_address = ''").Updates(map[string]interface{}{
+			"chain_id":         nftContract.ChainID,
+			"contract_address": common.HexToAddress(nftContract.Address).Hex(),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (handler *Handler) trackedContracts() ([]model.Contract, error) {
+	var contracts []model.Contract
+	err := handler.db.DB.Where("tracked = ?", true).Order("contract_id").Find(&contracts).Error
+	if err != nil {
+		return nil, err
+	}
+	return contracts, nil
+}
@@ -0,0 +1,341 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sushi/model"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
+	"gorm.io/gorm"
+)
+
+const CRAWL_INTERVAL = 1 * time.Minute // fallback poll when no real-time log arrives
+
+// Crawler owns the payment backfill of one network. Only one backfill runs at a time; real-time
+// logs just queue a trigger, and triggers arriving while one is pending are merged.
+type Crawler struct {
+	handler    *Handler
+	client     *ethclient.Client
+	network    *model.Network
+	abi        abi.ABI
+	timestamps *lru.Cache[uint64, uint64] // block number -> timestamp
+	ranges     *rangeSizer
+	trigger    chan struct{}
+	resync     chan uint64
+
+	mu              sync.RWMutex
+	headBlock       uint64
+	confirmedBlock  uint64
+	tempBlock       uint64
+	lastBackfillAt  *time.Time
+	lastBackfillDur time.Duration
+	lastBackfillErr string
+	logsProcessed   int
+}
+
+type CrawlerState struct {
+	ChainID              int64      `json:"chain_id"`
+	Network              string     `json:"network"`
+	HeadBlock            uint64     `json:"head_block"`
+	ConfirmedBlock       uint64     `json:"confirmed_block"`
+	TempBlock            uint64     `json:"temp_block"`
+	Lag                  uint64     `json:"lag"`
+	RangeSize            uint64     `json:"range_size"`
+	LastBackfillAt       *time.Time `json:"last_backfill_at,omitempty"`
+	LastBackfillDuration string     `json:"last_backfill_duration,omitempty"`
+	LastBackfillError    string     `json:"last_backfill_error,omitempty"`
+	LogsProcessed        int        `json:"logs_processed"`
+}
+
+// NewCrawler parses the network ABI once for all logs the crawler handles.
+func NewCrawler(handler *Handler, client *ethclient.Client, network *model.Network) (*Crawler, error) {
+	contractAbi, err := abi.JSON(strings.NewReader(network.ABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the %s contract ABI: %w", network.Name, err)
+	}
+	return &Crawler{
+		handler:    handler,
+		client:     client,
+		network:    network,
+		abi:        contractAbi,
+		timestamps: lru.NewCache[uint64, uint64](BLOCK_TIMESTAMP_CACHE_SIZE),
+		ranges:     newRangeSizer(),
+		trigger:    make(chan struct{}, 1),
+		resync:     make(chan uint64, 1),
+	}, nil
+}
+
+// Trigger queues a backfill. It never blocks: if one is already queued the call is a no-op.
+func (crawler *Crawler) Trigger() {
+	select {
+	case crawler.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Resync rewinds the confirmed cursor so the next backfill starts at fromBlock. The rewind is
+// done by the crawl loop itself so it cannot race a running backfill.
+func (crawler *Crawler) Resync(fromBlock uint64) {
+	select {
+	case <-crawler.resync:
+	default:
+	}
+	crawler.resync <- fromBlock
+}
+
+func (crawler *Crawler) State() CrawlerState {
+	crawler.mu.RLock()
+	defer crawler.mu.RUnlock()
+
+	state := CrawlerState{
+		ChainID:           crawler.network.ChainID,
+		Network:           crawler.network.Name,
+		HeadBlock:         crawler.headBlock,
+		ConfirmedBlock:    crawler.confirmedBlock,
+		TempBlock:         crawler.tempBlock,
+		LastBackfillAt:    crawler.lastBackfillAt,
+		LastBackfillError: crawler.lastBackfillErr,
+		LogsProcessed:     crawler.logsProcessed,
+		RangeSize:         crawler.ranges.Size(),
+	}
+	if crawler.lastBackfillAt != nil {
+		state.LastBackfillDuration = crawler.lastBackfillDur.String()
+	}
+	if state.HeadBlock > state.ConfirmedBlock {
+		state.Lag = state.HeadBlock - state.ConfirmedBlock
+	}
+	return state
+}
+
+// Run starts the real-time subscription and then serves the backfill queue until ctx is done
+// or a backfill fails; the supervisor restarts it in the latter case.
+func (crawler *Crawler) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go crawler.subscribeRealTimeEvents(ctx)
+
+	ticker := time.NewTicker(CRAWL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		err := crawler.backfill(ctx)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case fromBlock := <-crawler.resync:
+			err := crawler.handler.resetLatestBlock(crawler.network, fromBlock)
+			if err != nil {
+				return err
+			}
+			crawler.resetConfirmedBlock(fromBlock)
+		case <-ticker.C:
+		case <-crawler.trigger:
+			// give the triggering block time to be confirmed; triggers queued meanwhile
+			// are served by this same run
+			if !sleep(ctx, time.Duration(crawler.confirmations()*crawler.blockTime())*time.Second) {
+				return nil
+			}
+			select {
+			case <-crawler.trigger:
+			default:
+			}
+		}
+	}
+}
+
+// confirmations is the depth at which a payment of the network is final.
+func (crawler *Crawler) confirmations() uint64 {
+	if crawler.network.Confirmations == 0 {
+		return DEFAULT_BLOCK_CONFIRM
+	}
+	return crawler.network.Confirmations
+}
+
+func (crawler *Crawler) blockTime() uint64 {
+	if crawler.network.BlockTime == 0 {
+		return DEFAULT_BLOCK_TIME
+	}
+	return crawler.network.BlockTime
+}
+
+func (crawler *Crawler) setHeadBlock(blockNumber uint64) {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	if blockNumber > crawler.headBlock {
+		crawler.headBlock = blockNumber
+	}
+}
+
+func (crawler *Crawler) setConfirmedBlock(blockNumber uint64) {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	if blockNumber > crawler.confirmedBlock {
+		crawler.confirmedBlock = blockNumber
+	}
+}
+
+func (crawler *Crawler) resetConfirmedBlock(fromBlock uint64) {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	crawler.confirmedBlock = 0
+	if fromBlock > 0 {
+		crawler.confirmedBlock = fromBlock - 1
+	}
+}
+
+func (crawler *Crawler) setTempBlock(blockNumber uint64) {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	if blockNumber > crawler.tempBlock {
+		crawler.tempBlock = blockNumber
+	}
+}
+
+func (crawler *Crawler) backfill(ctx context.Context) error {
+	started := time.Now()
+	err := crawler.listenPastEvents(ctx)
+
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	crawler.lastBackfillAt = &started
+	crawler.lastBackfillDur = time.Since(started).Round(time.Millisecond)
+	crawler.lastBackfillErr = ""
+	if err != nil {
+		crawler.lastBackfillErr = err.Error()
+	}
+	return err
+}
+
+// listenPastEvents crawls confirmed blocks from the persisted cursor up to head - confirmations.
+// Each range is handled in one transaction together with its cursor update, so a range is
+// either fully recorded or not at all. A range the provider rejects is retried smaller; the
+// cursor never moves past a range that was not recorded.
+func (crawler *Crawler) listenPastEvents(ctx context.Context) error {
+	handler := crawler.handler
+
+	latestBlock, err := handler.getLatestBlock(crawler.network, false)
+	if err != nil {
+		return err
+	}
+	crawler.setConfirmedBlock(latestBlock.LatestBlockNumber)
+
+	latestBlockNumber, err := crawler.client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	crawler.setHeadBlock(latestBlockNumber)
+
+	if latestBlockNumber < crawler.confirmations() {
+		return nil
+	}
+	confirmedHead := latestBlockNumber - crawler.confirmations()
+
+	for fromBlock := latestBlock.LatestBlockNumber + 1; fromBlock <= confirmedHead; {
+		toBlock := crawler.ranges.end(fromBlock, confirmedHead)
+
+		query := ethereum.FilterQuery{
+			Addresses: []common.Address{common.HexToAddress(crawler.network.ContractAddress)},
+			FromBlock: new(big.Int).SetUint64(fromBlock),
+			ToBlock:   new(big.Int).SetUint64(toBlock),
+		}
+		logs, err := filterLogs(ctx, crawler.client, query)
+		if err != nil {
+			if isRangeError(ctx, err) && crawler.ranges.shrink() {
+				handler.log.Warn(crawler.network.Name, " blocks ", fromBlock, "-", toBlock, " rejected, retrying ", crawler.ranges.Size(), " blocks: ", err)
+				continue
+			}
+			return fmt.Errorf("blocks %d-%d: %w", fromBlock, toBlock, err)
+		}
+		err = crawler.prefetchTimestamps(ctx, logs)
+		if err != nil {
+			return fmt.Errorf("blocks %d-%d: %w", fromBlock, toBlock, err)
+		}
+
+		err = handler.db.DB.Transaction(func(tx *gorm.DB) error {
+			for _, log := range logs {
+				err := handler.handleLog(ctx, tx, crawler, log, model.Confirmed)
+				if err != nil {
+					return err
+				}
+			}
+			return handler.updateLatestBlock(tx, latestBlock.CrawlKey, toBlock)
+		})
+		if err != nil {
+			return fmt.Errorf("blocks %d-%d: %w", fromBlock, toBlock, err)
+		}
+		crawler.setConfirmedBlock(toBlock)
+		crawler.addLogsProcessed(len(logs))
+		processed(ctx, len(logs))
+		crawler.ranges.grow()
+		fromBlock = toBlock + 1
+	}
+	return nil
+}
+
+func (crawler *Crawler) addLogsProcessed(n int) {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	crawler.logsProcessed += n
+}
+
+func (crawler *Crawler) subscribeRealTimeEvents(ctx context.Context) {
+	handler := crawler.handler
+
+	latestBlock, err := handler.getLatestBlock(crawler.network, true)
+	if err != nil {
+		handler.log.Printf("Failed to get contract from database: %v", err)
+		return
+	}
+	crawler.setTempBlock(latestBlock.LatestBlockNumber)
+
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{common.HexToAddress(crawler.network.ContractAddress)},
+		FromBlock: new(big.Int).SetUint64(latestBlock.LatestBlockNumber + 1),
+	}
+
+	logs := make(chan types.Log)
+	sub := event.Resubscribe(2*time.Second, func(ctx context.Context) (event.Subscription, error) {
+		return crawler.client.SubscribeFilterLogs(ctx, query, logs)
+	})
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-sub.Err():
+			handler.log.Error(err)
+		case log := <-logs:
+			handler.log.Debug(crawler.network.Name, " log received: ", log.TxHash.Hex(), " log ", log.Index)
+			crawler.setHeadBlock(log.BlockNumber)
+			err := handler.db.DB.Transaction(func(tx *gorm.DB) error {
+				err := handler.handleLog(ctx, tx, crawler, log, model.Confirming)
+				if err != nil {
+					return err
+				}
+				return handler.updateLatestBlock(tx, latestBlock.CrawlKey, log.BlockNumber)
+			})
+			if err != nil {
+				handler.log.Error("Failed to handle real-time log: ", err)
+			} else {
+				crawler.setTempBlock(log.BlockNumber)
+			}
+			crawler.Trigger()
+		}
+	}
+}
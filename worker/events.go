@@ -0,0 +1,335 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sushi/model"
+	"sushi/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+// EventHandler applies one payment contract log inside tx. A returned error means the log
+// was not applied and the crawler must not advance its cursor past it.
+type EventHandler func(handler *Handler, ctx context.Context, tx *gorm.DB, crawler *Crawler, log types.Log, status model.ConfirmStatus) error
+
+// eventHandlers maps payment contract event names to their handlers. Events of the ABI
+// without a handler are ignored.
+var eventHandlers = map[string]EventHandler{
+	"PaymentReceived":      (*Handler).handlePaymentReceived,
+	"Refunded":             (*Handler).handleRefunded,
+	"SubscriptionExtended": (*Handler).handleSubscriptionExtended,
+	"PriceChanged":         (*Handler).handlePriceChanged,
+}
+
+// handleLog dispatches a payment contract log to the handler of its event.
+func (handler *Handler) handleLog(ctx context.Context, tx *gorm.DB, crawler *Crawler, log types.Log, status model.ConfirmStatus) error {
+	event, ok := crawler.event(log)
+	if !ok {
+		return nil
+	}
+	handle, ok := eventHandlers[event.Name]
+	if !ok {
+		return nil
+	}
+	return handle(handler, ctx, tx, crawler, log, status)
+}
+
+// event returns the ABI event of log, false if the ABI does not know it.
+func (crawler *Crawler) event(log types.Log) (*abi.Event, bool) {
+	if len(log.Topics) == 0 {
+		return nil, false
+	}
+	event, err := crawler.abi.EventByID(log.Topics[0])
+	if err != nil {
+		return nil, false
+	}
+	return event, true
+}
+
+// handles reports whether log is an event with a registered handler.
+func (crawler *Crawler) handles(log types.Log) bool {
+	event, ok := crawler.event(log)
+	if !ok {
+		return false
+	}
+	_, ok = eventHandlers[event.Name]
+	return ok
+}
+
+// unpackEvent decodes the indexed and data arguments of log by their ABI names.
+func unpackEvent(event *abi.Event, log types.Log) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	err := event.Inputs.NonIndexed().UnpackIntoMap(values, log.Data)
+	if err != nil {
+		return nil, err
+	}
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	err = abi.ParseTopicsIntoMap(values, indexed, log.Topics[1:])
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// eventValue returns the value of argument name of an unpacked event. Names are compared the way
+// UnpackIntoInterface matches struct fields, so "_payer" and "payer" are the same argument.
+func eventValue(values map[string]interface{}, name string) interface{} {
+	for key, value := range values {
+		if abi.ToCamelCase(key) == abi.ToCamelCase(name) {
+			return value
+		}
+	}
+	return nil
+}
+
+func eventAddress(values map[string]interface{}, name string) (common.Address, error) {
+	value, ok := eventValue(values, name).(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("event has no address argument %q", name)
+	}
+	return value, nil
+}
+
+func eventInt(values map[string]interface{}, name string) (*big.Int, error) {
+	value, ok := eventValue(values, name).(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("event has no uint256 argument %q", name)
+	}
+	return value, nil
+}
+
+// applyOnce records that a confirmed log was applied, returning false if it already was.
+// Handlers that change state outside recharge_nfts use it to stay idempotent across resyncs.
+func (handler *Handler) applyOnce(tx *gorm.DB, crawler *Crawler, log types.Log, name string) (bool, error) {
+	contractEvent := model.ContractEvent{
+		ChainID:     crawler.network.ChainID,
+		TxHash:      log.TxHash.Hex(),
+		LogIndex:    log.Index,
+		Name:        name,
+		BlockNumber: log.BlockNumber,
+	}
+	result := tx.Where(model.ContractEvent{ChainID: contractEvent.ChainID, TxHash: contractEvent.TxHash}).
+		Where("log_index = ?", contractEvent.LogIndex).
+		Limit(1).
+		Find(&model.ContractEvent{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return false, nil
+	}
+	return true, tx.Create(&contractEvent).Error
+}
+
+// rejectEvent records why a log recorded by applyOnce was not applied. The log is valid on
+// chain, so the crawl goes on past it instead of failing the range on it forever.
+func (handler *Handler) rejectEvent(tx *gorm.DB, crawler *Crawler, log types.Log, reason string) error {
+	handler.log.Warn(crawler.network.Name, " event not applied: ", log.TxHash.Hex(), " log ", log.Index, ": ", reason)
+	return tx.Model(&model.ContractEvent{}).
+		Where("chain_id = ? AND tx_hash = ? AND log_index = ?", crawler.network.ChainID, log.TxHash.Hex(), log.Index).
+		Update("reject_reason", reason).Error
+}
+
+// handleRefunded revokes what a refund paid back from the payer's subscription to the token. The
+// refund goes to the latest payment not yet fully refunded, and revokes the share of its
+// duration the refunded amount is of its amount; refunds beyond the payment revoke nothing more.
+// The subscription never ends before the refund block.
+//
+//	event Refunded(address indexed payer, uint256 nftId, uint256 amount)
+func (handler *Handler) handleRefunded(ctx context.Context, tx *gorm.DB, crawler *Crawler, log types.Log, status model.ConfirmStatus) error {
+	if status != model.Confirmed {
+		// only confirmed refunds revoke anything
+		return nil
+	}
+	event, _ := crawler.event(log)
+	values, err := unpackEvent(event, log)
+	if err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", event.Name, err)
+	}
+	payer, err := eventAddress(values, "payer")
+	if err != nil {
+		return err
+	}
+	nftId, err := eventInt(values, "nftId")
+	if err != nil {
+		return err
+	}
+	amount, err := eventInt(values, "amount")
+	if err != nil {
+		return err
+	}
+
+	apply, err := handler.applyOnce(tx, crawler, log, event.Name)
+	if err != nil || !apply {
+		return err
+	}
+
+	nft, err := handler.paidNFT(tx, crawler.network, nftId.String())
+	if err != nil {
+		return err
+	}
+	var recharges []model.RechargeNFT
+	err = tx.Where("payer = ? AND contract_address = ? AND token_id = ? AND status = ? AND reject_reason = ''", payer.Hex(), nft.ContractAddress, nft.TokenID, model.Confirmed).
+		Order("expiry_date DESC").
+		Find(&recharges).Error
+	if err != nil {
+		return err
+	}
+	var recharge *model.RechargeNFT
+	var paid, refunded *big.Int
+	for i := range recharges {
+		var ok bool
+		paid, ok = utils.ParseAmount(recharges[i].Amount)
+		if !ok || paid.Sign() == 0 {
+			continue
+		}
+		refunded, ok = utils.ParseAmount(recharges[i].Refunded)
+		if !ok {
+			refunded = new(big.Int)
+		}
+		if refunded.Cmp(paid) < 0 {
+			recharge = &recharges[i]
+			break
+		}
+	}
+	if recharge == nil {
+		handler.log.Warn("refund without a payment left to refund: ", payer.Hex(), " token ", nftId)
+		return nil
+	}
+
+	refund := new(big.Int).Sub(paid, refunded)
+	if amount.Cmp(refund) < 0 {
+		refund.Set(amount)
+	} else if amount.Cmp(refund) > 0 {
+		handler.log.Warn("refund of ", amount, " exceeds what is left of payment ", recharge.TxHash, ": ", refund)
+	}
+	total := new(big.Int).Add(refunded, refund)
+	err = tx.Model(&model.RechargeNFT{}).
+		Where("tx_hash = ? AND log_index = ?", recharge.TxHash, recharge.LogIndex).
+		Update("refunded", total.String()).Error
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := crawler.blockTimestamp(ctx, log.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("failed to fetch block %d: %w", log.BlockNumber, err)
+	}
+	current, err := handler.subscriptionExpiry(tx, recharge.Payer, nft)
+	if err != nil {
+		return err
+	}
+	duration := new(big.Int).SetUint64(recharge.Duration)
+	if recharge.Duration == 0 {
+		// recorded before pricing
+		duration.SetUint64(uint64(handler.conf.NFTExpiryTime()))
+	}
+	// the shares of all refunds so far minus those revoked before, so rounding never adds up to
+	// more than the payment bought
+	revoked := new(big.Int).Mul(duration, total)
+	revoked.Div(revoked, paid)
+	revoked.Sub(revoked, new(big.Int).Div(new(big.Int).Mul(duration, refunded), paid))
+
+	expiryDate := timestamp
+	if revoked.IsUint64() && current > revoked.Uint64() && current-revoked.Uint64() > timestamp {
+		expiryDate = current - revoked.Uint64()
+	}
+	if expiryDate >= current {
+		return nil
+	}
+	handler.log.Info("refund: ", payer.Hex(), " token ", nftId, " expiry ", current, " -> ", expiryDate)
+	return handler.setSubscriptionExpiry(tx, recharge.Payer, nft, expiryDate)
+}
+
+// handleSubscriptionExtended adds duration seconds to the payer's access to a token, counted
+// from the later of the current expiry and the extension block.
+//
+//	event SubscriptionExtended(address indexed payer, uint256 nftId, uint256 duration)
+func (handler *Handler) handleSubscriptionExtended(ctx context.Context, tx *gorm.DB, crawler *Crawler, log types.Log, status model.ConfirmStatus) error {
+	if status != model.Confirmed {
+		return nil
+	}
+	event, _ := crawler.event(log)
+	values, err := unpackEvent(event, log)
+	if err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", event.Name, err)
+	}
+	payer, err := eventAddress(values, "payer")
+	if err != nil {
+		return err
+	}
+	nftId, err := eventInt(values, "nftId")
+	if err != nil {
+		return err
+	}
+	duration, err := eventInt(values, "duration")
+	if err != nil {
+		return err
+	}
+
+	apply, err := handler.applyOnce(tx, crawler, log, event.Name)
+	if err != nil || !apply {
+		return err
+	}
+	if !duration.IsUint64() {
+		return handler.rejectEvent(tx, crawler, log, fmt.Sprintf("duration %s is out of range", duration))
+	}
+
+	timestamp, err := crawler.blockTimestamp(ctx, log.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("failed to fetch block %d: %w", log.BlockNumber, err)
+	}
+
+	nft, err := handler.paidNFT(tx, crawler.network, nftId.String())
+	if err != nil {
+		return err
+	}
+	current, err := handler.subscriptionExpiry(tx, payer.Hex(), nft)
+	if err != nil {
+		return err
+	}
+	expiryDate := extendFrom(current, timestamp) + duration.Uint64()
+	if expiryDate < current {
+		return handler.rejectEvent(tx, crawler, log, fmt.Sprintf("duration %s overflows the expiry", duration))
+	}
+	return handler.setSubscriptionExpiry(tx, payer.Hex(), nft, expiryDate)
+}
+
+// handlePriceChanged sets the minimum amount of a token to the price announced by the contract.
+//
+//	event PriceChanged(address token, uint256 price)
+func (handler *Handler) handlePriceChanged(ctx context.Context, tx *gorm.DB, crawler *Crawler, log types.Log, status model.ConfirmStatus) error {
+	if status != model.Confirmed {
+		return nil
+	}
+	event, _ := crawler.event(log)
+	values, err := unpackEvent(event, log)
+	if err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", event.Name, err)
+	}
+	token, err := eventAddress(values, "token")
+	if err != nil {
+		return err
+	}
+	price, err := eventInt(values, "price")
+	if err != nil {
+		return err
+	}
+
+	apply, err := handler.applyOnce(tx, crawler, log, event.Name)
+	if err != nil || !apply {
+		return err
+	}
+	handler.log.Info(crawler.network.Name, " price changed: token ", token.Hex(), " price ", price)
+	return handler.setMinAmount(tx, crawler.network, token, price)
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+
+	"sushi/model"
+	"sushi/utils/DB"
+	"sushi/utils/DB/dbtest"
+	"sushi/utils/config"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+const testPaymentABI = `[
+	{"anonymous":false,"name":"Refunded","type":"event","inputs":[
+		{"indexed":true,"name":"payer","type":"address"},
+		{"indexed":false,"name":"nftId","type":"uint256"},
+		{"indexed":false,"name":"amount","type":"uint256"}]}
+]`
+
+func newTestCrawler(t *testing.T, tables ...interface{}) *Crawler {
+	t.Helper()
+	db := dbtest.Open(t, append([]interface{}{&model.ContractEvent{}, &model.Contract{}}, tables...)...)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	handler := &Handler{db: &DB.DB{DB: db}, log: log, conf: &config.Config{}}
+
+	paymentABI, err := abi.JSON(strings.NewReader(testPaymentABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Crawler{
+		handler:    handler,
+		network:    &model.Network{ChainID: 137, Name: "polygon", NFTContractAddress: testContractAddress},
+		abi:        paymentABI,
+		timestamps: lru.NewCache[uint64, uint64](BLOCK_TIMESTAMP_CACHE_SIZE),
+	}
+}
+
+func TestHandleRefundedPartially(t *testing.T) {
+	crawler := newTestCrawler(t, &model.RechargeNFT{}, &model.Subscription{})
+	handler := crawler.handler
+	db := handler.db.DB
+	nft := nftKey{ChainID: 137, ContractAddress: common.HexToAddress(testContractAddress).Hex(), TokenID: "1"}
+
+	// 100 tokens bought 1000 seconds up to 11000; refunds are made at 5000
+	err := db.Create(&model.RechargeNFT{
+		TxHash:          "0xpayment",
+		Payer:           alice.Hex(),
+		ChainID:         nft.ChainID,
+		ContractAddress: nft.ContractAddress,
+		TokenID:         nft.TokenID,
+		StartDate:       10000,
+		ExpiryDate:      11000,
+		Amount:          "100",
+		Duration:        1000,
+		Status:          model.Confirmed,
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = handler.setSubscriptionExpiry(db, alice.Hex(), nft, 11000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.timestamps.Add(50, 5000)
+
+	refunds := []struct {
+		amount   int64
+		expiry   uint64
+		refunded string
+	}{
+		{30, 10700, "30"},
+		// only 70 are left to refund
+		{100, 10000, "100"},
+		{10, 10000, "100"},
+	}
+	for i, refund := range refunds {
+		data, err := crawler.abi.Events["Refunded"].Inputs.NonIndexed().Pack(big.NewInt(1), big.NewInt(refund.amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		log := types.Log{
+			Topics:      []common.Hash{crawler.abi.Events["Refunded"].ID, addressTopic(alice)},
+			Data:        data,
+			BlockNumber: 50,
+			TxHash:      common.BigToHash(big.NewInt(int64(i + 1))),
+		}
+		err = handler.handleRefunded(context.Background(), db, crawler, log, model.Confirmed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expiry, err := handler.subscriptionExpiry(db, alice.Hex(), nft)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var recharge model.RechargeNFT
+		err = db.Where("tx_hash = ?", "0xpayment").First(&recharge).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expiry != refund.expiry || recharge.Refunded != refund.refunded {
+			t.Fatalf("refund %d: expiry %d, refunded %s, want %d and %s", i+1, expiry, recharge.Refunded, refund.expiry, refund.refunded)
+		}
+	}
+}
@@ -4,35 +4,40 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"math/big"
 	"net/http"
-	"strings"
+	"sort"
 	"sushi/model"
 	"sushi/utils/DB"
 	"sushi/utils/config"
+	"sushi/utils/custom_errors"
+	"sync"
 	"time"
 
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/event"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	db   *DB.DB
-	log  *logrus.Logger
-	conf *config.Config
-	Ctx  *context.Context
+	db      *DB.DB
+	log     *logrus.Logger
+	conf    *config.Config
+	Ctx     *context.Context
+	indexer Indexer
+
+	mu       sync.RWMutex
+	crawlers map[int64]*Crawler // by chain id
 }
 
 type GetOwnersForContractResponse struct {
 	Owners  []OwnerResponse `json:"owners"`
 	PageKey *string         `json:"pageKey"`
+	// block the owners were read at, 0 when the indexer does not say
+	BlockNumber uint64 `json:"-"`
 }
 
 type OwnerResponse struct {
@@ -76,146 +81,273 @@ type Metadata struct {
 	Attributes  []model.Attributes `json:"attributes"`
 }
 
-const AVG_BLOCK_CONFIRM = 5       // block confirmation
-const AVG_BLOCK_TIME = 2          // block confirmation timestamp (seconds)
+const DEFAULT_BLOCK_CONFIRM = 5   // block confirmation, unless set on the network
+const DEFAULT_BLOCK_TIME = 2      // block confirmation timestamp (seconds), unless set on the network
 const AVG_BLOCK_PER_QUERY = 10000 // block per query
 
-func NewHandler(worker *Worker) *Handler {
-	ctx, _ := context.WithCancel(context.Background())
-	return &Handler{
-		log:  worker.log,
-		conf: worker.config,
-		db:   worker.db,
-		Ctx:  &ctx,
+// NewHandler returns a handler with the indexer selected by indexer_provider.
+func NewHandler(worker *Worker) (*Handler, error) {
+	handler := &Handler{
+		log:      worker.log,
+		conf:     worker.config,
+		db:       worker.db,
+		Ctx:      &worker.ctx,
+		crawlers: make(map[int64]*Crawler),
+	}
+	// the rpc indexer reads the contracts the transfer sync follows, from the same RPC
+	indexer, err := NewIndexer(worker.config, handler.nftRPCURL)
+	if err != nil {
+		return nil, err
 	}
+	handler.indexer = indexer
+	return handler, nil
 }
 func (handler *Handler) HandleLog() {
 	fmt.Printf("welcome %s", handler.conf.APIKey())
 }
 
-func (handler *Handler) GetOwnersForContract() {
-	fmt.Println("Get Owner For Contract Job Started")
-	var pageKey *string
-	res := handler.db.DB.Where("token_type = ?", handler.conf.TokenType()).Delete(&model.Owner{})
-	if res.Error != nil {
-		handler.log.Error("Failed to delete old owner:", res.Error)
+// GetOwnersForContract takes a fresh owner snapshot of every tracked contract and refreshes
+// their NFTs. A failed contract does not keep the others from being crawled.
+func (handler *Handler) GetOwnersForContract(ctx context.Context) error {
+	contracts, err := handler.trackedContracts()
+	if err != nil {
+		return fmt.Errorf("failed to get tracked contracts: %w", err)
+	}
+	failed := 0
+	for i := range contracts {
+		err := handler.getOwnersForContract(ctx, &contracts[i])
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			handler.log.Error("Failed to get owners for contract ", contracts[i].Address, ": ", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to get owners for %d of %d contracts", failed, len(contracts))
+	}
+	return nil
+}
+
+// getOwnersForContract writes the snapshot of contract as a staging generation and only
+// replaces the active one once every page was stored, so a failed crawl leaves the previous
+// snapshot in place.
+func (handler *Handler) getOwnersForContract(ctx context.Context, contract *model.Contract) error {
+	fmt.Println("Get Owner For Contract Job Started", contract.Address)
+	// an indexer that does not report its block is taken to include everything confirmed now
+	block, err := handler.confirmedNFTHead(ctx, contract)
+	if err != nil {
+		return err
+	}
+	active, err := handler.activeOwnerGeneration(handler.db.DB, contract.ContractID)
+	if err != nil {
+		return err
+	}
+	staging := active + 1
+
+	// leftovers of a crawl that failed before it could clean up
+	err = handler.deleteOwnerGenerations(handler.db.DB.Where("generation > ?", active), contract.ContractID)
+	if err != nil {
+		return fmt.Errorf("failed to delete staging owners: %w", err)
+	}
+
+	indexed, err := handler.crawlOwners(ctx, contract, staging)
+	if err != nil {
+		cleanupErr := handler.deleteOwnerGenerations(handler.db.DB.Where("generation = ?", staging), contract.ContractID)
+		if cleanupErr != nil {
+			handler.log.Error("Failed to delete staging owners: ", cleanupErr)
+		}
+		return err
+	}
+
+	if indexed > 0 {
+		block = indexed
 	}
+	err = handler.switchOwnerGeneration(contract, staging, block)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Get Owner For Contract Job Done", contract.Address)
+	return handler.getNFTsForOwners(ctx, contract)
+}
+
+// crawlOwners stores the indexer snapshot of contract as generation and returns the block the
+// indexer read it at, 0 if it did not say.
+func (handler *Handler) crawlOwners(ctx context.Context, contract *model.Contract, generation uint64) (uint64, error) {
+	var pageKey *string
+	var block uint64
 	for {
-		params := ""
-		if pageKey != nil {
-			params = fmt.Sprintf("&pageKey=%s", *pageKey)
+		result, err := handler.indexer.GetOwnersForContract(ctx, contract, pageKey)
+		if err != nil {
+			return 0, err
+		}
+		if pageKey == nil {
+			block = result.BlockNumber
+		}
+		for _, v := range result.Owners {
+			err := handler.createOwner(contract, v, generation)
+			if err != nil {
+				return 0, fmt.Errorf("failed to store owner %s: %w", v.OwnerAddress, err)
+			}
+			processed(ctx, 1)
+		}
+		if result.PageKey == nil {
+			return block, nil
 		}
+		pageKey = result.PageKey
+	}
+}
+
+// ownerGeneration returns the snapshot pointer of a contract, creating it on first use.
+func (handler *Handler) ownerGeneration(tx *gorm.DB, contractID uint64) (*model.OwnerGeneration, error) {
+	generation := model.OwnerGeneration{ContractID: contractID}
+	result := tx.Where(model.OwnerGeneration{ContractID: contractID}).FirstOrCreate(&generation)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &generation, nil
+}
+
+// activeOwnerGeneration returns the generation readers see.
+func (handler *Handler) activeOwnerGeneration(tx *gorm.DB, contractID uint64) (uint64, error) {
+	generation, err := handler.ownerGeneration(tx, contractID)
+	if err != nil {
+		return 0, err
+	}
+	return generation.Active, nil
+}
 
-		url := fmt.Sprintf("https://%s.g.alchemy.com/nft/v3/%s/getOwnersForContract?contractAddress=%s&withTokenBalances=true%s", handler.conf.Network(), handler.conf.APIKey(), handler.conf.NFTContractAddress(), params)
-		resp, err := http.Get(url)
+// switchOwnerGeneration makes generation, taken at block, the active snapshot and drops every
+// other one. The transfer cursor is rewound to block in the same transaction, so the transfers
+// after the snapshot are applied to it again and those it includes are not.
+func (handler *Handler) switchOwnerGeneration(contract *model.Contract, generation uint64, block uint64) error {
+	return handler.db.DB.Transaction(func(tx *gorm.DB) error {
+		if block > 0 {
+			// first, so a transfer range being applied finishes before the swap or fails after it
+			err := handler.setOwnerCursor(tx, contract, block)
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Model(&model.OwnerGeneration{}).Where("contract_id = ?", contract.ContractID).Updates(map[string]interface{}{
+			"active": generation,
+			"block":  block,
+		}).Error
 		if err != nil {
-			handler.log.Error("Failed to make a request:", err)
+			return err
 		}
-		defer resp.Body.Close()
+		return handler.deleteOwnerGenerations(tx.Where("generation <> ?", generation), contract.ContractID)
+	})
+}
+
+func (handler *Handler) deleteOwnerGenerations(query *gorm.DB, contractID uint64) error {
+	return query.Where("contract_id = ?", contractID).Delete(&model.Owner{}).Error
+}
+
+func (handler *Handler) getNFTsForOwners(ctx context.Context, contract *model.Contract) error {
+	fmt.Println("Get NFTs For Owners Job Started", contract.Address)
 
-		body, err := ioutil.ReadAll(resp.Body)
+	owners, err := handler.findAllOwners(contract.ContractID)
+	if err != nil {
+		return fmt.Errorf("failed to get owners: %w", err)
+	}
+	failed := 0
+	for _, owner := range *owners {
+		err := handler.getNFTsForOwner(ctx, contract, owner.Address)
 		if err != nil {
-			handler.log.Error("Failed to read the response body:", err)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			handler.log.Error("Failed to get NFTs for owner ", owner.Address, ": ", err)
+			failed++
 		}
+	}
+	fmt.Println("Get NFTs For Owners Job Done", contract.Address)
+	if failed > 0 {
+		return fmt.Errorf("failed to get NFTs for %d of %d owners", failed, len(*owners))
+	}
+	return nil
+}
 
-		var result GetOwnersForContractResponse
-		err = json.Unmarshal([]byte(body), &result)
+func (handler *Handler) getNFTsForOwner(ctx context.Context, contract *model.Contract, owner string) error {
+	var pageKey *string
+	for {
+		result, err := handler.indexer.GetNFTsForOwner(ctx, owner, contract, pageKey)
 		if err != nil {
-			handler.log.Error("Failed to json unmarshal:", err)
+			return err
 		}
-		if result.Owners != nil {
-			for _, v := range result.Owners {
-				err := handler.createOwner(v)
+		if result.OwnedNfts != nil {
+			for _, v := range result.OwnedNfts {
+				err := handler.updateOrCreateNFT(contract, &v)
 				if err != nil {
 					continue
 				}
+				processed(ctx, 1)
 			}
 		}
 		if result.PageKey != nil {
 			pageKey = result.PageKey
 		} else {
-			break
+			return nil
 		}
-		time.Sleep(10 * time.Second)
 	}
-	fmt.Println("Get Owner For Contract Job Done")
-	handler.getNFTsForOwners()
 }
 
-func (handler *Handler) getNFTsForOwners() {
-	fmt.Println("Get NFTs For Owners Job Started")
-
-	owners, err := handler.findAllOwners()
+// getJSON fetches url and decodes the JSON body into out.
+func getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		handler.log.Error("Failed to get Owners:", err)
+		return err
 	}
-	for _, owner := range *owners {
-
-		var pageKey *string
-		for {
-			params := ""
-			if pageKey != nil {
-				params = fmt.Sprintf("&pageKey=%s", *pageKey)
-			}
-
-			url := fmt.Sprintf("https://%s.g.alchemy.com/nft/v3/%s/getNFTsForOwner?owner=%s&contractAddresses[]=%s&withMetadata=true&pageSize=100%s", handler.conf.Network(), handler.conf.APIKey(), owner.Address, handler.conf.NFTContractAddress(), params)
-			resp, err := http.Get(url)
-			if err != nil {
-				handler.log.Error("Failed to make a request:", err)
-			}
-			defer resp.Body.Close()
-
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				handler.log.Error("Failed to read the response body:", err)
-			}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make a request: %w", err)
+	}
+	defer resp.Body.Close()
 
-			var result NftsResponse
-			err = json.Unmarshal([]byte(body), &result)
-			if err != nil {
-				handler.log.Error("Failed to json unmarshal:", err)
-			}
-			if result.OwnedNfts != nil {
-				for _, v := range result.OwnedNfts {
-					err := handler.updateOrCreateNFT(&v)
-					if err != nil {
-						continue
-					}
-				}
-			}
-			if result.PageKey != nil {
-				pageKey = result.PageKey
-			} else {
-				break
-			}
-			time.Sleep(10 * time.Second)
-		}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
 	}
-	fmt.Println("Get NFTs For Owners Job Done")
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return fmt.Errorf("failed to json unmarshal: %w", err)
+	}
+	return nil
 }
 
-func (handler *Handler) findAllOwners() (*[]model.Owner, error) {
+func (handler *Handler) findAllOwners(contractID uint64) (*[]model.Owner, error) {
 	var owners []model.Owner
-	err := handler.db.DB.Distinct("address").Where("token_type = ? ", handler.conf.TokenType()).Select("address").Group("address").Find(&owners).Error
+	active, err := handler.activeOwnerGeneration(handler.db.DB, contractID)
+	if err != nil {
+		return nil, err
+	}
+	err = handler.db.DB.Distinct("address").Where("contract_id = ? AND generation = ?", contractID, active).Select("address").Group("address").Find(&owners).Error
 	if err != nil {
 		return nil, err
 	}
 	return &owners, nil
 }
 
-func (handler *Handler) findOrCreateContract(contract *model.Contract) (*model.Contract, error) {
-
-	result := handler.db.DB.Where("address = ?", contract.Address).Assign(model.Contract{Address: contract.Address}).FirstOrCreate(&contract)
-
-	if result.Error != nil {
-		return nil, result.Error
-	}
-	return contract, nil
+// updateContractMetadata fills in the descriptive fields of a tracked contract the first time
+// the indexer reports them.
+func (handler *Handler) updateContractMetadata(tx *gorm.DB, contract *model.Contract, metadata *model.Contract) error {
+	return tx.Model(contract).Updates(model.Contract{
+		Name:                metadata.Name,
+		Symbol:              metadata.Symbol,
+		TotalSupply:         metadata.TotalSupply,
+		ContractDeployer:    metadata.ContractDeployer,
+		DeployedBlockNumber: metadata.DeployedBlockNumber,
+	}).Error
 }
 
-func (handler *Handler) findOrCreateCollection(collection *model.Collection) (*model.Collection, error) {
+func (handler *Handler) findOrCreateCollection(tx *gorm.DB, collection *model.Collection) (*model.Collection, error) {
 
-	result := handler.db.DB.Where(model.Collection{Slug: collection.Slug}).Assign(model.Collection{Slug: collection.Slug}).FirstOrCreate(&collection)
+	result := tx.Where(model.Collection{Slug: collection.Slug}).Assign(model.Collection{Slug: collection.Slug}).FirstOrCreate(&collection)
 
 	if result.Error != nil {
 		return nil, result.Error
@@ -223,15 +355,15 @@ func (handler *Handler) findOrCreateCollection(collection *model.Collection) (*m
 	return collection, nil
 }
 
-func (handler *Handler) createOrUpdateNFT(nftMeta *NFTMetaData, contract *model.Contract, collection *model.Collection) error {
+func (handler *Handler) createOrUpdateNFT(tx *gorm.DB, nftMeta *NFTMetaData, contract *model.Contract, collection *model.Collection) error {
 
 	var nft model.NFT
-	result := handler.db.DB.Where(model.NFT{TokenId: nftMeta.TokenId, TokenType: handler.conf.TokenType()}).First(&nft)
+	result := tx.Where(model.NFT{ContractID: contract.ContractID, TokenId: nftMeta.TokenId}).First(&nft)
 
 	nft = model.NFT{
 		ContractID:      contract.ContractID,
 		TokenId:         nftMeta.TokenId,
-		TokenType:       handler.conf.TokenType(),
+		TokenType:       contract.TokenType,
 		Name:            nftMeta.Name,
 		Description:     nftMeta.Description,
 		TokenUri:        nftMeta.TokenUri,
@@ -240,15 +372,15 @@ func (handler *Handler) createOrUpdateNFT(nftMeta *NFTMetaData, contract *model.
 	}
 
 	if result.Error != nil {
-		result := handler.db.DB.Create(&nft)
+		result := tx.Create(&nft)
 		if result.Error != nil {
 			return result.Error
 		}
-		err := handler.createOrUpdateNftImage(nft.TokenId, nftMeta.Image)
+		err := handler.createOrUpdateNftImage(tx, contract, nft.TokenId, nftMeta.Image)
 		if err != nil {
 			return err
 		}
-		err = handler.createAttributes(nft.TokenId, nftMeta.Raw.Metadata.Attributes)
+		err = handler.createAttributes(tx, contract, nft.TokenId, nftMeta.Raw.Metadata.Attributes)
 		if err != nil {
 			return err
 		}
@@ -257,15 +389,15 @@ func (handler *Handler) createOrUpdateNFT(nftMeta *NFTMetaData, contract *model.
 
 	if result.RowsAffected >= 1 {
 		//nft exits
-		result := handler.db.DB.Where(model.NFT{TokenId: nft.TokenId, TokenType: handler.conf.TokenType()}).Updates(nft)
+		result := tx.Where(model.NFT{ContractID: contract.ContractID, TokenId: nft.TokenId}).Updates(nft)
 		if result.Error != nil {
 			return result.Error
 		}
-		err := handler.createOrUpdateNftImage(nft.TokenId, nftMeta.Image)
+		err := handler.createOrUpdateNftImage(tx, contract, nft.TokenId, nftMeta.Image)
 		if err != nil {
 			return err
 		}
-		err = handler.createAttributes(nft.TokenId, nftMeta.Raw.Metadata.Attributes)
+		err = handler.createAttributes(tx, contract, nft.TokenId, nftMeta.Raw.Metadata.Attributes)
 		if err != nil {
 			return err
 		}
@@ -274,11 +406,12 @@ func (handler *Handler) createOrUpdateNFT(nftMeta *NFTMetaData, contract *model.
 	return nil
 }
 
-func (handler *Handler) createOrUpdateNftImage(tokenId string, nftImage model.NFTImage) error {
+func (handler *Handler) createOrUpdateNftImage(tx *gorm.DB, contract *model.Contract, tokenId string, nftImage model.NFTImage) error {
 	var image model.NFTImage
-	result := handler.db.DB.Where(model.NFTImage{TokenId: tokenId, TokenType: handler.conf.TokenType()}).First(&image)
+	result := tx.Where(model.NFTImage{ContractID: contract.ContractID, TokenId: tokenId}).First(&image)
 
 	image = model.NFTImage{
+		ContractID:   contract.ContractID,
 		TokenId:      tokenId,
 		CachedUrl:    nftImage.CachedUrl,
 		ThumbnailUrl: nftImage.ThumbnailUrl,
@@ -286,11 +419,11 @@ func (handler *Handler) createOrUpdateNftImage(tokenId string, nftImage model.NF
 		ContentType:  nftImage.ContentType,
 		Size:         nftImage.Size,
 		OriginalUrl:  nftImage.OriginalUrl,
-		TokenType:    handler.conf.TokenType(),
+		TokenType:    contract.TokenType,
 	}
 
 	if result.Error != nil {
-		result := handler.db.DB.Create(&image)
+		result := tx.Create(&image)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -299,7 +432,7 @@ func (handler *Handler) createOrUpdateNftImage(tokenId string, nftImage model.NF
 
 	if result.RowsAffected >= 1 {
 		//nft exits
-		result := handler.db.DB.Where(model.NFTImage{TokenId: image.TokenId, TokenType: handler.conf.TokenType()}).Updates(&image)
+		result := tx.Where(model.NFTImage{ContractID: contract.ContractID, TokenId: image.TokenId}).Updates(&image)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -309,17 +442,21 @@ func (handler *Handler) createOrUpdateNftImage(tokenId string, nftImage model.NF
 	return nil
 }
 
-func (handler *Handler) createAttributes(tokenId string, attributes []model.Attributes) error {
-	handler.db.DB.Where(model.Attributes{TokenId: tokenId, TokenType: handler.conf.TokenType()}).Delete(&model.Attributes{})
+func (handler *Handler) createAttributes(tx *gorm.DB, contract *model.Contract, tokenId string, attributes []model.Attributes) error {
+	err := tx.Where(model.Attributes{ContractID: contract.ContractID, TokenId: tokenId}).Delete(&model.Attributes{}).Error
+	if err != nil {
+		return err
+	}
 
 	for _, v := range attributes {
 		var attribute = model.Attributes{
-			Type:      v.Type,
-			Rarity:    v.Rarity,
-			TokenId:   tokenId,
-			TokenType: handler.conf.TokenType(),
+			ContractID: contract.ContractID,
+			Type:       v.Type,
+			Rarity:     v.Rarity,
+			TokenId:    tokenId,
+			TokenType:  contract.TokenType,
 		}
-		result := handler.db.DB.Create(&attribute)
+		result := tx.Create(&attribute)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -327,21 +464,25 @@ func (handler *Handler) createAttributes(tokenId string, attributes []model.Attr
 	return nil
 }
 
-func (handler *Handler) updateOrCreateNFT(nftMetaData *NFTMetaData) error {
+// updateOrCreateNFT stores an NFT of the tracked contract; the contract reported by the
+// indexer is not trusted over the one that was queried.
+func (handler *Handler) updateOrCreateNFT(contract *model.Contract, nftMetaData *NFTMetaData) error {
 
 	er := handler.db.DB.Transaction(func(tx *gorm.DB) error {
 
-		contract, err := handler.findOrCreateContract(&nftMetaData.Contract)
-		if err != nil {
-			return err
+		if contract.Name == "" {
+			err := handler.updateContractMetadata(tx, contract, &nftMetaData.Contract)
+			if err != nil {
+				return err
+			}
 		}
 
-		collection, err := handler.findOrCreateCollection(&nftMetaData.Collection)
+		collection, err := handler.findOrCreateCollection(tx, &nftMetaData.Collection)
 		if err != nil {
 			return err
 		}
 
-		err = handler.createOrUpdateNFT(nftMetaData, contract, collection)
+		err = handler.createOrUpdateNFT(tx, nftMetaData, contract, collection)
 		if err != nil {
 			return err
 		}
@@ -356,17 +497,22 @@ func (handler *Handler) updateOrCreateNFT(nftMetaData *NFTMetaData) error {
 	return nil
 }
 
-func (handler *Handler) createOwner(owner OwnerResponse) error {
+func (handler *Handler) createOwner(contract *model.Contract, owner OwnerResponse, generation uint64) error {
 	var owners []model.Owner
 
 	for _, v := range owner.TokenBalances {
 		owners = append(owners, model.Owner{
-			Address:   owner.OwnerAddress,
-			TokenId:   v.TokenId,
-			Balance:   v.Balance,
-			TokenType: handler.conf.TokenType(),
+			ContractID: contract.ContractID,
+			Address:    owner.OwnerAddress,
+			TokenId:    v.TokenId,
+			Balance:    v.Balance,
+			TokenType:  contract.TokenType,
+			Generation: generation,
 		})
 	}
+	if len(owners) == 0 {
+		return nil
+	}
 
 	result := handler.db.DB.Create(&owners)
 
@@ -376,108 +522,193 @@ func (handler *Handler) createOwner(owner OwnerResponse) error {
 	return nil
 }
 
-func (handler *Handler) CrawlFromWeb3() {
-	go func() {
-		network, err := handler.getNetwork()
-		if err != nil {
-			handler.log.Printf("Failed to get network from database: %v", err)
-		}
+// CrawlFromWeb3 connects to a payment network and runs its crawler until ctx is done
+// or the crawler fails.
+func (handler *Handler) CrawlFromWeb3(ctx context.Context, network *model.Network) error {
+	client, err := ethclient.DialContext(ctx, network.RpcUrl)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the %s client: %w", network.Name, err)
+	}
+	defer client.Close()
 
-		client, err := ethclient.Dial(network.RpcUrl)
-		if err != nil {
-			handler.log.Printf("Failed to connect to the %s client: %v", network.Name, err)
-		}
-		defer client.Close()
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the %s chain id: %w", network.Name, err)
+	}
+	if chainID.Int64() != network.ChainID {
+		return fmt.Errorf("the %s rpc is on chain %s, expected %d", network.Name, chainID, network.ChainID)
+	}
 
-		handler.listenPastEvents(client)
-		handler.subscribeRealTimeEvents(client)
+	crawler, err := NewCrawler(handler, client, network)
+	if err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	handler.crawlers[network.ChainID] = crawler
+	handler.mu.Unlock()
+	defer func() {
+		handler.mu.Lock()
+		delete(handler.crawlers, network.ChainID)
+		handler.mu.Unlock()
 	}()
+
+	return crawler.Run(ctx)
+}
+
+// CrawlerStates reports the progress of the running payment crawlers, ordered by chain id.
+func (handler *Handler) CrawlerStates() []CrawlerState {
+	handler.mu.RLock()
+	defer handler.mu.RUnlock()
+
+	states := make([]CrawlerState, 0, len(handler.crawlers))
+	for _, crawler := range handler.crawlers {
+		states = append(states, crawler.State())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ChainID < states[j].ChainID
+	})
+	return states
 }
 
-func (handler *Handler) createRecharge(payer string, received string, tokenAddress string, tokenId string, expiryDate uint64, amount uint64, status model.ConfirmStatus) error {
+// createRecharge records a payment. A credited payment buys the period from the later of its
+// block timestamp and the payer's current expiry; once confirmed it extends the subscription.
+func (handler *Handler) createRecharge(tx *gorm.DB, log types.Log, payer string, received string, tokenAddress string, nft nftKey, timestamp uint64, amount string, credit credit, status model.ConfirmStatus) error {
 	recharge := model.RechargeNFT{
-		Payer:        payer,
-		Received:     received,
-		TokenAddress: tokenAddress,
-		TokenID:      tokenId,
-		ExpiryDate:   expiryDate,
-		Amount:       amount,
-		Status:       status,
+		TxHash:          log.TxHash.Hex(),
+		LogIndex:        log.Index,
+		Payer:           payer,
+		Received:        received,
+		TokenAddress:    tokenAddress,
+		ChainID:         nft.ChainID,
+		ContractAddress: nft.ContractAddress,
+		TokenID:         nft.TokenID,
+		Amount:          amount,
+		Duration:        credit.duration,
+		RejectReason:    credit.rejectReason,
+		Status:          status,
+	}
+	if credit.credited() {
+		// renewing early adds the whole duration after the current expiry
+		expiryDate, err := handler.subscriptionExpiry(tx, payer, nft)
+		if err != nil {
+			return err
+		}
+		recharge.StartDate = extendFrom(expiryDate, timestamp)
+		recharge.ExpiryDate = recharge.StartDate + credit.duration
 	}
 
-	var exist model.RechargeNFT
+	var confirming int64
+	err := tx.Model(&model.RechargeNFT{}).
+		Where("tx_hash = ? AND log_index = ? AND status = ?", recharge.TxHash, recharge.LogIndex, model.Confirming).
+		Count(&confirming).Error
+	if err != nil {
+		return err
+	}
+	if status == model.Confirmed && confirming > 0 {
+		// the confirming record becomes the confirmed one
+		err = tx.Model(&model.RechargeNFT{}).
+			Where("tx_hash = ? AND log_index = ? AND status = ?", recharge.TxHash, recharge.LogIndex, model.Confirming).
+			Select("start_date", "expiry_date", "duration", "reject_reason", "status").
+			Updates(&recharge).Error
+	} else {
+		err = tx.Create(&recharge).Error
+	}
+	if err != nil {
+		return err
+	}
 
-	result := handler.db.DB.Where(model.RechargeNFT{Payer: payer}).Order("expiry_date DESC").First(&exist)
-	if result.Error != nil {
-		// User first recharge in db
-		result = handler.db.DB.Create(&recharge)
-		if result.Error != nil {
-			return result.Error
-		}
+	if status != model.Confirmed || !credit.credited() {
 		return nil
 	}
-	// if User already recharge and has expiry date
-	if exist.ExpiryDate > uint64(time.Now().Unix()) {
-		recharge.ExpiryDate = exist.ExpiryDate
+	return handler.setSubscriptionExpiry(tx, payer, nft, recharge.ExpiryDate)
+}
+
+// updateLatestBlock moves the cursor forward; a lower block number than the stored one is ignored.
+func (handler *Handler) updateLatestBlock(tx *gorm.DB, crawlKey string, latestBlock uint64) error {
+	latestBlockInDB := model.LatestBlock{
+		CrawlKey:          crawlKey,
+		LatestBlockNumber: latestBlock,
 	}
-	// save data
-	var rechargeNft model.RechargeNFT
-	result = handler.db.DB.Where(model.RechargeNFT{Payer: payer, TokenID: tokenId, Status: model.Confirming}).Last(&rechargeNft)
+	result := tx.Where(model.LatestBlock{CrawlKey: crawlKey}).FirstOrCreate(&latestBlockInDB)
 	if result.Error != nil {
-		// no record found create new record
-		result = handler.db.DB.Create(&recharge)
-		if result.Error != nil {
-			return result.Error
-		}
-		return nil
+		return result.Error
 	}
-	if status == model.Confirmed {
-		// found the record, update status to confirmed
-		recharge.Status = model.Confirmed
-		result = handler.db.DB.Where(model.RechargeNFT{Payer: payer, TokenID: tokenId, Status: model.Confirming}).Updates(&recharge)
-		if result.Error != nil {
-			return result.Error
-		}
+	result = tx.Model(&model.LatestBlock{}).
+		Where("crawl_key = ? AND latest_block_number < ?", crawlKey, latestBlock).
+		Update("latest_block_number", latestBlock)
+	if result.Error != nil {
+		return result.Error
 	}
 	return nil
 }
 
-func (handler *Handler) updateLatestBlock(latestBlock uint64, block *model.LatestBlock) error {
-	var latestBlockInDB model.LatestBlock
-
-	result := handler.db.DB.Where(model.LatestBlock{CrawlKey: block.CrawlKey}).First(&latestBlockInDB)
-	latestBlockInDB = model.LatestBlock{
-		CrawlKey:          block.CrawlKey,
-		LatestBlockNumber: latestBlock,
+// resetLatestBlock moves the confirmed cursor so the next backfill starts at fromBlock,
+// backwards if need be.
+func (handler *Handler) resetLatestBlock(network *model.Network, fromBlock uint64) error {
+	latestBlock, err := handler.getLatestBlock(network, false)
+	if err != nil {
+		return err
 	}
-
+	var blockNumber uint64
+	if fromBlock > 0 {
+		blockNumber = fromBlock - 1
+	}
+	result := handler.db.DB.Model(&model.LatestBlock{}).
+		Where("crawl_key = ?", latestBlock.CrawlKey).
+		Update("latest_block_number", blockNumber)
 	if result.Error != nil {
-		result := handler.db.DB.Create(&latestBlockInDB)
-		if result.Error != nil {
-			return result.Error
-		}
-	} else if result.RowsAffected >= 1 {
-		result := handler.db.DB.Where(model.LatestBlock{CrawlKey: block.CrawlKey}).Updates(&latestBlockInDB)
-		if result.Error != nil {
-			return result.Error
-		}
+		return result.Error
 	}
+	handler.log.Info(network.Name, " payment crawler resync from block ", fromBlock)
 	return nil
 }
 
-func (handler *Handler) getLatestBlock(isTemp bool) (*model.LatestBlock, error) {
-	var key string
+// ResyncPayments re-crawls confirmed payments of a network starting at fromBlock.
+func (handler *Handler) ResyncPayments(chainID int64, fromBlock uint64) error {
+	handler.mu.RLock()
+	crawler := handler.crawlers[chainID]
+	handler.mu.RUnlock()
+
+	if crawler != nil {
+		crawler.Resync(fromBlock)
+		return nil
+	}
+	network, err := handler.getNetworkByChainID(chainID)
+	if err != nil {
+		return err
+	}
+	return handler.resetLatestBlock(network, fromBlock)
+}
+
+// getLatestBlock returns a cursor of network, starting it at the network start block.
+// Cursors written when only one network was crawled are carried over.
+func (handler *Handler) getLatestBlock(network *model.Network, isTemp bool) (*model.LatestBlock, error) {
+	var key, legacyKey string
 	if isTemp {
-		key = fmt.Sprintf("crawl_temp_%s", handler.conf.PaymentContractAddress())
+		key = fmt.Sprintf("crawl_temp_%d_%s", network.ChainID, network.ContractAddress)
+		legacyKey = fmt.Sprintf("crawl_temp_%s", network.ContractAddress)
 	} else {
-		key = fmt.Sprintf("crawl_polygon_%s", handler.conf.PaymentContractAddress())
+		key = fmt.Sprintf("crawl_%d_%s", network.ChainID, network.ContractAddress)
+		legacyKey = fmt.Sprintf("crawl_polygon_%s", network.ContractAddress)
 	}
 
 	latestBlock := model.LatestBlock{
 		CrawlKey:          key,
 		LatestBlockNumber: handler.conf.SyncBlockNumber(),
 	}
-	result := handler.db.DB.Where(model.LatestBlock{CrawlKey: key}).FirstOrCreate(&latestBlock)
+	if network.StartBlock > 0 {
+		latestBlock.LatestBlockNumber = network.StartBlock - 1
+	}
+	var legacy model.LatestBlock
+	result := handler.db.DB.Where(model.LatestBlock{CrawlKey: legacyKey}).Limit(1).Find(&legacy)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		latestBlock.LatestBlockNumber = legacy.LatestBlockNumber
+	}
+
+	result = handler.db.DB.Where(model.LatestBlock{CrawlKey: key}).FirstOrCreate(&latestBlock)
 	if result.Error != nil {
 		return nil, result.Error
 
@@ -485,168 +716,128 @@ func (handler *Handler) getLatestBlock(isTemp bool) (*model.LatestBlock, error)
 	return &latestBlock, nil
 }
 
-func (handler *Handler) getNetwork() (*model.Network, error) {
-	var network model.Network
-
-	result := handler.db.DB.Where(model.Network{ContractAddress: handler.conf.PaymentContractAddress()}).First(&network)
+// getNetworks returns the payment networks to crawl, one per chain id.
+func (handler *Handler) getNetworks() ([]model.Network, error) {
+	var networks []model.Network
+	result := handler.db.DB.Order("chain_id").Find(&networks)
 	if result.Error != nil {
 		return nil, result.Error
-
 	}
-	return &network, nil
-}
 
-func (handler *Handler) getTimeStamp(blocknumber int64, client *ethclient.Client) uint64 {
-	block, err := client.BlockByNumber(*handler.Ctx, big.NewInt(blocknumber))
-	if err != nil {
-		handler.log.Printf("Failed to fetch block: %v", err)
-		return 0
+	unique := make([]model.Network, 0, len(networks))
+	seen := make(map[int64]bool)
+	for _, network := range networks {
+		if seen[network.ChainID] {
+			handler.log.Error("skipping network ", network.Name, ": chain id ", network.ChainID, " is already crawled")
+			continue
+		}
+		seen[network.ChainID] = true
+		unique = append(unique, network)
 	}
-	return block.Time()
+	return unique, nil
 }
 
-func (handler *Handler) listenPastEvents(client *ethclient.Client) {
-	latestBlock, err := handler.getLatestBlock(false)
-	if err != nil {
-		handler.log.Printf("Failed to get contract from database: %v", err)
+func (handler *Handler) getNetworkByChainID(chainID int64) (*model.Network, error) {
+	var network model.Network
+	result := handler.db.DB.Where("chain_id = ?", chainID).Limit(1).Find(&network)
+	if result.Error != nil {
+		return nil, result.Error
 	}
-
-	network, err := handler.getNetwork()
-	if err != nil {
-		handler.log.Printf("Failed to get network from database: %v", err)
+	if result.RowsAffected == 0 {
+		return nil, custom_errors.NETWORK_NOT_FOUND_ERROR
 	}
+	return &network, nil
+}
 
-	var fromBlock = latestBlock.LatestBlockNumber + 1
-	var toBlock = fromBlock + AVG_BLOCK_PER_QUERY
-
-	latestBlockNumber, err := client.BlockNumber(*handler.Ctx)
+// handlePaymentReceived records a payment of the crawler network inside tx.
+func (handler *Handler) handlePaymentReceived(ctx context.Context, tx *gorm.DB, crawler *Crawler, log types.Log, status model.ConfirmStatus) error {
+	abiEvent, _ := crawler.event(log)
+	values, err := unpackEvent(abiEvent, log)
 	if err != nil {
-		handler.log.Error(err)
+		return fmt.Errorf("failed to unpack %s: %w", abiEvent.Name, err)
 	}
-
-	for ok := true; ok; ok = toBlock-AVG_BLOCK_PER_QUERY < latestBlockNumber-AVG_BLOCK_CONFIRM {
-		if toBlock > latestBlockNumber-AVG_BLOCK_CONFIRM {
-			toBlock = latestBlockNumber - AVG_BLOCK_CONFIRM
-		}
-
-		query := ethereum.FilterQuery{
-			Addresses: []common.Address{common.HexToAddress(handler.conf.PaymentContractAddress())},
-			FromBlock: big.NewInt(int64(fromBlock)),
-			ToBlock:   big.NewInt(int64(toBlock)),
-		}
-
-		logs, err := client.FilterLogs(*handler.Ctx, query)
-		if err != nil {
-			handler.log.Error(err)
-		}
-		for _, log := range logs {
-			handler.handleLog(log, client, network.ABI, latestBlock, model.Confirmed)
-		}
-		err = handler.updateLatestBlock(toBlock, latestBlock)
+	var event struct {
+		Payer        common.Address
+		Receiver     common.Address
+		TokenAddress common.Address
+		NftId        *big.Int
+		Amount       *big.Int
+	}
+	for name, address := range map[string]*common.Address{"payer": &event.Payer, "receiver": &event.Receiver, "tokenAddress": &event.TokenAddress} {
+		*address, err = eventAddress(values, name)
 		if err != nil {
-			handler.log.Println("error to update Latest Block")
+			return err
 		}
-		fromBlock = toBlock + 1
-		toBlock += AVG_BLOCK_PER_QUERY
 	}
-}
-
-func (handler *Handler) subscribeRealTimeEvents(client *ethclient.Client) {
-	latestBlock, err := handler.getLatestBlock(true)
+	event.NftId, err = eventInt(values, "nftId")
 	if err != nil {
-		handler.log.Printf("Failed to get contract from database: %v", err)
+		return err
 	}
-
-	network, err := handler.getNetwork()
+	event.Amount, err = eventInt(values, "amount")
 	if err != nil {
-		handler.log.Printf("Failed to get network from database: %v", err)
+		return err
 	}
 
-	var fromBlock = latestBlock.LatestBlockNumber + 1
-
-	query := ethereum.FilterQuery{
-		Addresses: []common.Address{common.HexToAddress(handler.conf.PaymentContractAddress())},
-		FromBlock: big.NewInt(int64(fromBlock)),
+	// a resync or resubscription can deliver the same log again
+	var count int64
+	result := tx.Model(&model.RechargeNFT{}).
+		Where("tx_hash = ? AND log_index = ? AND status IN ?", log.TxHash.Hex(), log.Index, []model.ConfirmStatus{status, model.Confirmed}).
+		Count(&count)
+	if result.Error != nil {
+		return result.Error
+	}
+	if count > 0 {
+		return nil
 	}
 
-	logs := make(chan types.Log)
-	sub := event.Resubscribe(2*time.Second, func(ctx context.Context) (event.Subscription, error) {
-		return client.SubscribeFilterLogs(ctx, query, logs)
-	})
-	defer sub.Unsubscribe()
+	handler.log.Debug(crawler.network.Name, " payment: ", event)
 
-	for {
-		select {
-		case err := <-sub.Err():
-			handler.log.Error(err)
-		case log := <-logs:
-			fmt.Printf("Received log %s \n", log.BlockHash)
-			handler.handleLog(log, client, network.ABI, latestBlock, model.Confirming)
-			go func() {
-				time.Sleep(AVG_BLOCK_CONFIRM * AVG_BLOCK_TIME * time.Second)
-				handler.listenPastEvents(client)
-			}()
-		}
+	timestamp, err := crawler.blockTimestamp(ctx, log.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("failed to fetch block %d: %w", log.BlockNumber, err)
 	}
-}
-
-func (handler *Handler) handleLog(log types.Log, client *ethclient.Client, ABI string, latestBlock *model.LatestBlock, status model.ConfirmStatus) {
-	event := struct {
-		Payer        common.Address
-		Receiver     common.Address
-		TokenAddress common.Address
-		NftId        *big.Int
-		Amount       *big.Int
-	}{}
-	contractAbi, err := abi.JSON(strings.NewReader(ABI))
+	nft, err := handler.paidNFT(tx, crawler.network, event.NftId.String())
 	if err != nil {
-		handler.log.Printf("Failed to parse contract ABI: %v \n", err)
+		return err
+	}
+	credit, err := handler.priceCredit(tx, crawler.network, event.TokenAddress, event.Amount)
+	if err != nil {
+		return err
+	}
+	if !credit.credited() {
+		handler.log.Warn("payment not credited: ", log.TxHash.Hex(), " ", credit.rejectReason)
 	}
 
-	err = contractAbi.UnpackIntoInterface(&event, "PaymentReceived", log.Data)
-	if err == nil {
-		if len(log.Topics) > 0 {
-			event.Payer = common.HexToAddress(log.Topics[1].Hex())
-		}
-
-		handler.log.Println("Event:", event)
-
-		expiryDate := handler.getTimeStamp(int64(log.BlockNumber), client) + uint64(handler.conf.NFTExpiryTime())
-
-		err = handler.createRecharge(event.Payer.Hex(), event.Receiver.Hex(), event.TokenAddress.Hex(), event.NftId.String(), expiryDate, event.Amount.Uint64(), status)
+	err = handler.createRecharge(tx, log, event.Payer.Hex(), event.Receiver.Hex(), event.TokenAddress.Hex(), nft, timestamp, event.Amount.String(), credit, status)
+	if err != nil {
+		return err
+	}
+	if status == model.Confirmed && credit.credited() {
+		// a payer without a linked player is not an error for the crawl
+		err = handler.updateScore(tx, event.Payer.Hex())
 		if err != nil {
 			handler.log.Error(err.Error())
 		}
-		if status == model.Confirmed {
-			err = handler.updateScore(event.Payer.Hex())
-			if err != nil {
-				handler.log.Error(err.Error())
-			}
-		}
-	}
-
-	err = handler.updateLatestBlock(log.BlockNumber, latestBlock)
-	if err != nil {
-		handler.log.Println("error to update Latest Block")
 	}
+	return nil
 }
 
-func (handler *Handler) updateScore(payer string) error {
+func (handler *Handler) updateScore(tx *gorm.DB, payer string) error {
 
-	player, err := handler.getPlayerByEthAddress(payer)
+	player, err := handler.getPlayerByEthAddress(tx, payer)
 	if err != nil {
 		return err
 	}
 
 	var freebieEarnTotal model.FreebieEarnTotal
 
-	result := handler.db.DB.Where("user_id = ? AND expiry_date > UNIX_TIMESTAMP(NOW()) AND charge_date <= 0", player.UserId).Last(&freebieEarnTotal)
+	result := tx.Where("user_id = ? AND expiry_date > UNIX_TIMESTAMP(NOW()) AND charge_date <= 0", player.UserId).Last(&freebieEarnTotal)
 	if result.Error != nil {
 		// no freebieEarn
 		return result.Error
 	} else {
 		freebieEarnTotal.ChargeDate = uint64(time.Now().Unix())
-		err = handler.db.DB.Save(&freebieEarnTotal).Error
+		err = tx.Save(&freebieEarnTotal).Error
 		if err != nil {
 			return err
 		}
@@ -654,9 +845,10 @@ func (handler *Handler) updateScore(payer string) error {
 	}
 }
 
-func (handler *Handler) getPlayerByEthAddress(ethAddress string) (model.Player, error) {
+func (handler *Handler) getPlayerByEthAddress(tx *gorm.DB, ethAddress string) (model.Player, error) {
 	var player model.Player
-	result := handler.db.DB.Where("eth_address = ?", ethAddress).First(&player)
+	// any wallet of the player, addresses linked before they were checksummed may differ in case
+	result := tx.Where("user_id = (SELECT user_id FROM player_wallets WHERE lower(address) = lower(?))", ethAddress).First(&player)
 	if result.Error != nil {
 		return model.Player{}, result.Error
 	}
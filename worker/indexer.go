@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sushi/model"
+	"sushi/utils/config"
+	"time"
+)
+
+// Indexer is the source of NFT ownership and metadata. Pages are addressed by an opaque
+// page key, nil for the first page; a nil PageKey in the response means the last page.
+type Indexer interface {
+	GetOwnersForContract(ctx context.Context, contract *model.Contract, pageKey *string) (*GetOwnersForContractResponse, error)
+	GetNFTsForOwner(ctx context.Context, owner string, contract *model.Contract, pageKey *string) (*NftsResponse, error)
+}
+
+// NewIndexer returns the indexer selected by indexer_provider. The rpc indexer reads each
+// contract through the endpoint rpcURL resolves for it.
+func NewIndexer(conf *config.Config, rpcURL func(contract *model.Contract) (string, error)) (Indexer, error) {
+	switch conf.IndexerProvider() {
+	case "alchemy":
+		return NewAlchemyIndexer(conf.APIKey()), nil
+	case "rpc":
+		return NewRPCIndexer(rpcURL), nil
+	case "file":
+		return NewFileIndexer(conf.IndexerFilePath()), nil
+	}
+	return nil, fmt.Errorf("unknown indexer_provider %q", conf.IndexerProvider())
+}
+
+const ALCHEMY_PAGE_DELAY = 10 * time.Second // keep under the Alchemy compute unit rate
+
+// AlchemyIndexer queries the Alchemy NFT API of the contract's chain.
+type AlchemyIndexer struct {
+	apiKey string
+}
+
+func NewAlchemyIndexer(apiKey string) *AlchemyIndexer {
+	return &AlchemyIndexer{apiKey: apiKey}
+}
+
+func (indexer *AlchemyIndexer) GetOwnersForContract(ctx context.Context, contract *model.Contract, pageKey *string) (*GetOwnersForContractResponse, error) {
+	params := ""
+	if pageKey != nil {
+		params = fmt.Sprintf("&pageKey=%s", *pageKey)
+		if !sleep(ctx, ALCHEMY_PAGE_DELAY) {
+			return nil, ctx.Err()
+		}
+	}
+
+	url := fmt.Sprintf("https://%s.g.alchemy.com/nft/v3/%s/getOwnersForContract?contractAddress=%s&withTokenBalances=true%s", contract.Chain, indexer.apiKey, contract.Address, params)
+	var result GetOwnersForContractResponse
+	err := getJSON(ctx, url, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (indexer *AlchemyIndexer) GetNFTsForOwner(ctx context.Context, owner string, contract *model.Contract, pageKey *string) (*NftsResponse, error) {
+	params := ""
+	if pageKey != nil {
+		params = fmt.Sprintf("&pageKey=%s", *pageKey)
+		if !sleep(ctx, ALCHEMY_PAGE_DELAY) {
+			return nil, ctx.Err()
+		}
+	}
+
+	url := fmt.Sprintf("https://%s.g.alchemy.com/nft/v3/%s/getNFTsForOwner?owner=%s&contractAddresses[]=%s&withMetadata=true&pageSize=100%s", contract.Chain, indexer.apiKey, owner, contract.Address, params)
+	var result NftsResponse
+	err := getJSON(ctx, url, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sushi/model"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const IPFS_GATEWAY = "https://ipfs.io/ipfs/"
+
+// RPCIndexer rebuilds ownership from the contract's transfer logs and reads metadata through
+// tokenURI (ERC721) or uri (ERC1155), needing nothing but the contract's JSON-RPC endpoint.
+type RPCIndexer struct {
+	rpcURL   func(contract *model.Contract) (string, error)
+	mu       sync.Mutex
+	clients  map[string]*ethclient.Client
+	balances map[common.Address]map[common.Address]map[string]*big.Int // contract -> owner -> token id
+}
+
+// NewRPCIndexer reads each contract through the endpoint rpcURL resolves for it.
+func NewRPCIndexer(rpcURL func(contract *model.Contract) (string, error)) *RPCIndexer {
+	return &RPCIndexer{
+		rpcURL:   rpcURL,
+		clients:  make(map[string]*ethclient.Client),
+		balances: make(map[common.Address]map[common.Address]map[string]*big.Int),
+	}
+}
+
+// GetOwnersForContract rescans the whole transfer history and returns every owner in one page.
+func (indexer *RPCIndexer) GetOwnersForContract(ctx context.Context, contract *model.Contract, pageKey *string) (*GetOwnersForContractResponse, error) {
+	balances, block, err := indexer.scan(ctx, contract)
+	if err != nil {
+		return nil, err
+	}
+
+	result := GetOwnersForContractResponse{BlockNumber: block}
+	for owner, tokens := range balances {
+		response := OwnerResponse{OwnerAddress: owner.Hex()}
+		for tokenId, balance := range tokens {
+			response.TokenBalances = append(response.TokenBalances, TokenBalance{
+				TokenId: tokenId,
+				Balance: balance.String(),
+			})
+		}
+		result.Owners = append(result.Owners, response)
+	}
+	sort.Slice(result.Owners, func(i, j int) bool {
+		return result.Owners[i].OwnerAddress < result.Owners[j].OwnerAddress
+	})
+	return &result, nil
+}
+
+// GetNFTsForOwner uses the balances of the last owner scan, scanning first if there was none.
+func (indexer *RPCIndexer) GetNFTsForOwner(ctx context.Context, owner string, contract *model.Contract, pageKey *string) (*NftsResponse, error) {
+	indexer.mu.Lock()
+	balances, ok := indexer.balances[common.HexToAddress(contract.Address)]
+	indexer.mu.Unlock()
+	if !ok {
+		var err error
+		balances, _, err = indexer.scan(ctx, contract)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result NftsResponse
+	for tokenId, balance := range balances[common.HexToAddress(owner)] {
+		nft, err := indexer.getNFT(ctx, contract, tokenId)
+		if err != nil {
+			return nil, err
+		}
+		nft.Balance = balance.String()
+		result.OwnedNfts = append(result.OwnedNfts, *nft)
+	}
+	result.TotalCount = len(result.OwnedNfts)
+	return &result, nil
+}
+
+func (indexer *RPCIndexer) client(contract *model.Contract) (*ethclient.Client, error) {
+	rpcUrl, err := indexer.rpcURL(contract)
+	if err != nil {
+		return nil, err
+	}
+
+	indexer.mu.Lock()
+	defer indexer.mu.Unlock()
+	client, ok := indexer.clients[rpcUrl]
+	if !ok {
+		client, err = ethclient.Dial(rpcUrl)
+		if err != nil {
+			return nil, err
+		}
+		indexer.clients[rpcUrl] = client
+	}
+	return client, nil
+}
+
+// scan replays the transfer logs of contract up to the confirmed head, the block owner transfers
+// are applied up to, and returns the balances and that block.
+func (indexer *RPCIndexer) scan(ctx context.Context, contract *model.Contract) (map[common.Address]map[string]*big.Int, uint64, error) {
+	client, err := indexer.client(contract)
+	if err != nil {
+		return nil, 0, err
+	}
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if head < DEFAULT_BLOCK_CONFIRM {
+		return nil, 0, fmt.Errorf("chain head %d is below %d confirmations", head, DEFAULT_BLOCK_CONFIRM)
+	}
+	head -= DEFAULT_BLOCK_CONFIRM
+
+	address := common.HexToAddress(contract.Address)
+	balances := make(map[common.Address]map[string]*big.Int)
+	ranges := newRangeSizer()
+	for fromBlock := contract.FromBlock; fromBlock <= head; {
+		toBlock := ranges.end(fromBlock, head)
+		logs, err := filterLogs(ctx, client, ethereum.FilterQuery{
+			Addresses: []common.Address{address},
+			Topics:    transferTopics(),
+			FromBlock: new(big.Int).SetUint64(fromBlock),
+			ToBlock:   new(big.Int).SetUint64(toBlock),
+		})
+		if err != nil {
+			if isRangeError(ctx, err) && ranges.shrink() {
+				continue
+			}
+			return nil, 0, fmt.Errorf("blocks %d-%d: %w", fromBlock, toBlock, err)
+		}
+		for _, log := range logs {
+			transfers, err := decodeTransfers(log)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, transfer := range transfers {
+				addBalance(balances, transfer.From, transfer.TokenId, new(big.Int).Neg(transfer.Amount))
+				addBalance(balances, transfer.To, transfer.TokenId, transfer.Amount)
+			}
+		}
+		ranges.grow()
+		fromBlock = toBlock + 1
+	}
+
+	indexer.mu.Lock()
+	indexer.balances[address] = balances
+	indexer.mu.Unlock()
+	return balances, head, nil
+}
+
+func addBalance(balances map[common.Address]map[string]*big.Int, owner common.Address, tokenId *big.Int, amount *big.Int) {
+	if owner == (common.Address{}) {
+		// mint or burn
+		return
+	}
+	tokens, ok := balances[owner]
+	if !ok {
+		tokens = make(map[string]*big.Int)
+		balances[owner] = tokens
+	}
+	id := tokenId.String()
+	balance, ok := tokens[id]
+	if !ok {
+		balance = new(big.Int)
+	}
+	balance.Add(balance, amount)
+	if balance.Sign() <= 0 {
+		delete(tokens, id)
+		if len(tokens) == 0 {
+			delete(balances, owner)
+		}
+		return
+	}
+	tokens[id] = balance
+}
+
+func (indexer *RPCIndexer) getNFT(ctx context.Context, contract *model.Contract, tokenId string) (*NFTMetaData, error) {
+	id, ok := new(big.Int).SetString(tokenId, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid token id %s", tokenId)
+	}
+	tokenUri, err := indexer.tokenURI(ctx, contract, id)
+	if err != nil {
+		return nil, err
+	}
+
+	nft := NFTMetaData{
+		Contract:  model.Contract{Address: contract.Address, TokenType: contract.TokenType},
+		TokenId:   tokenId,
+		TokenType: contract.TokenType,
+		TokenUri:  tokenUri,
+		Raw:       Raw{TokenUri: tokenUri},
+	}
+	// metadata hosting is out of our hands, an unreachable document still yields the token
+	var metadata Metadata
+	if getJSON(ctx, resolveURI(tokenUri), &metadata) == nil {
+		nft.Name = metadata.Name
+		nft.Description = metadata.Description
+		nft.Image.OriginalUrl = resolveURI(metadata.Image)
+		nft.Raw.Metadata = metadata
+	}
+	return &nft, nil
+}
+
+func (indexer *RPCIndexer) tokenURI(ctx context.Context, contract *model.Contract, tokenId *big.Int) (string, error) {
+	client, err := indexer.client(contract)
+	if err != nil {
+		return "", err
+	}
+	method := "tokenURI"
+	if contract.TokenType == "ERC1155" {
+		method = "uri"
+	}
+	data, err := nftABI.Pack(method, tokenId)
+	if err != nil {
+		return "", err
+	}
+	address := common.HexToAddress(contract.Address)
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s(%s): %w", method, tokenId, err)
+	}
+	values, err := nftABI.Unpack(method, output)
+	if err != nil {
+		return "", err
+	}
+	uri := values[0].(string)
+	if contract.TokenType == "ERC1155" {
+		// ERC-1155 metadata URI: lowercase hex id, zero padded to 64 characters
+		uri = strings.ReplaceAll(uri, "{id}", fmt.Sprintf("%064x", tokenId))
+	}
+	return uri, nil
+}
+
+func resolveURI(uri string) string {
+	if strings.HasPrefix(uri, "ipfs://") {
+		return IPFS_GATEWAY + strings.TrimPrefix(uri, "ipfs://")
+	}
+	return uri
+}
@@ -0,0 +1,359 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sushi/model"
+	"sushi/utils/custom_errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gorm.io/gorm"
+)
+
+const OWNER_SYNC_INTERVAL = 1 * time.Minute
+
+// SyncOwnersFromTransfers keeps the owner table current by applying the transfer events of
+// every tracked contract as they are confirmed. The full crawl in GetOwnersForContract only runs
+// as a periodic consistency check on top of it.
+func (handler *Handler) SyncOwnersFromTransfers(ctx context.Context) error {
+	contracts, err := handler.trackedContracts()
+	if err != nil {
+		return fmt.Errorf("failed to get tracked contracts: %w", err)
+	}
+
+	clients := make(map[string]*ethclient.Client)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	for i := range contracts {
+		rpcUrl, err := handler.nftRPCURL(&contracts[i])
+		if err != nil {
+			return err
+		}
+		if _, ok := clients[rpcUrl]; ok {
+			continue
+		}
+		client, err := ethclient.DialContext(ctx, rpcUrl)
+		if err != nil {
+			return fmt.Errorf("failed to connect to the %s chain: %w", contracts[i].Chain, err)
+		}
+		clients[rpcUrl] = client
+	}
+	for i := range contracts {
+		if contracts[i].ChainID == 0 {
+			continue
+		}
+		rpcUrl, _ := handler.nftRPCURL(&contracts[i])
+		chainID, err := clients[rpcUrl].ChainID(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the chain id of the %s chain: %w", contracts[i].Chain, err)
+		}
+		if chainID.Int64() != contracts[i].ChainID {
+			return fmt.Errorf("rpc of contract %s is on chain %s, not %d", contracts[i].Address, chainID, contracts[i].ChainID)
+		}
+	}
+
+	for {
+		for i := range contracts {
+			contract := &contracts[i]
+			rpcUrl, _ := handler.nftRPCURL(contract)
+			err := handler.syncOwnerTransfers(ctx, clients[rpcUrl], contract)
+			if err != nil {
+				return fmt.Errorf("contract %s: %w", contract.Address, err)
+			}
+		}
+		if !sleep(ctx, OWNER_SYNC_INTERVAL) {
+			return nil
+		}
+	}
+}
+
+// nftRPCURL is the RPC of the contract, or the RPC of the payment network on the contract's
+// chain id.
+func (handler *Handler) nftRPCURL(contract *model.Contract) (string, error) {
+	if contract.RpcUrl != "" {
+		return contract.RpcUrl, nil
+	}
+	if contract.ChainID == 0 {
+		return "", fmt.Errorf("contract %s has neither rpc_url nor chain_id", contract.Address)
+	}
+	network, err := handler.getNetworkByChainID(contract.ChainID)
+	if err != nil {
+		return "", fmt.Errorf("no rpc_url for contract %s and no payment network on chain %d: %w", contract.Address, contract.ChainID, err)
+	}
+	return network.RpcUrl, nil
+}
+
+func (handler *Handler) syncOwnerTransfers(ctx context.Context, client *ethclient.Client, contract *model.Contract) error {
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	if head < DEFAULT_BLOCK_CONFIRM {
+		return nil
+	}
+	confirmedHead := head - DEFAULT_BLOCK_CONFIRM
+
+	cursor, err := handler.getOwnerCursor(contract)
+	if err != nil {
+		return err
+	}
+
+	address := common.HexToAddress(contract.Address)
+	ranges := newRangeSizer()
+	for fromBlock := cursor.LatestBlockNumber + 1; fromBlock <= confirmedHead; {
+		toBlock := ranges.end(fromBlock, confirmedHead)
+
+		logs, err := filterLogs(ctx, client, ethereum.FilterQuery{
+			Addresses: []common.Address{address},
+			Topics:    transferTopics(),
+			FromBlock: new(big.Int).SetUint64(fromBlock),
+			ToBlock:   new(big.Int).SetUint64(toBlock),
+		})
+		if err != nil {
+			if isRangeError(ctx, err) && ranges.shrink() {
+				continue
+			}
+			return fmt.Errorf("blocks %d-%d: %w", fromBlock, toBlock, err)
+		}
+
+		received, err := handler.applyOwnerTransfers(cursor.CrawlKey, contract, fromBlock, toBlock, logs)
+		if errors.Is(err, custom_errors.OWNER_CURSOR_MOVED_ERROR) {
+			// a consistency crawl swapped in a new snapshot and rewound the cursor to its block
+			cursor, err = handler.getOwnerCursor(contract)
+			if err != nil {
+				return err
+			}
+			fromBlock = cursor.LatestBlockNumber + 1
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("blocks %d-%d: %w", fromBlock, toBlock, err)
+		}
+		processed(ctx, len(logs))
+
+		handler.fetchMissingNFTs(ctx, contract, received)
+		ranges.grow()
+		fromBlock = toBlock + 1
+	}
+	return nil
+}
+
+// applyOwnerTransfers applies the transfers in logs of blocks fromBlock-toBlock to the active
+// snapshot and returns the tokens received per owner. The cursor is moved past the range first and
+// only from fromBlock-1, so a snapshot swap, which rewinds it, either waits for the range or makes
+// it fail with OWNER_CURSOR_MOVED_ERROR.
+func (handler *Handler) applyOwnerTransfers(cursorKey string, contract *model.Contract, fromBlock uint64, toBlock uint64, logs []types.Log) (map[string][]string, error) {
+	received := make(map[string][]string)
+	err := handler.db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.LatestBlock{}).
+			Where("crawl_key = ? AND latest_block_number = ?", cursorKey, fromBlock-1).
+			Update("latest_block_number", toBlock)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return custom_errors.OWNER_CURSOR_MOVED_ERROR
+		}
+		for _, log := range logs {
+			transfers, err := decodeTransfers(log)
+			if err != nil {
+				return err
+			}
+			for _, transfer := range transfers {
+				err = handler.addOwnerBalance(tx, contract, transfer.From, transfer.TokenId, new(big.Int).Neg(transfer.Amount))
+				if err != nil {
+					return err
+				}
+				err = handler.addOwnerBalance(tx, contract, transfer.To, transfer.TokenId, transfer.Amount)
+				if err != nil {
+					return err
+				}
+				if transfer.To != (common.Address{}) {
+					to := ownerAddress(transfer.To)
+					received[to] = append(received[to], transfer.TokenId.String())
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return received, nil
+}
+
+// getOwnerCursor returns the transfer cursor of contract. A new cursor starts at the block the
+// active snapshot was taken at, so transfers since the snapshot are applied on top of it. Without
+// a recorded block the snapshot cannot be trusted as a base for deltas; it is dropped and the
+// owners are built from the contract's from_block.
+func (handler *Handler) getOwnerCursor(contract *model.Contract) (*model.LatestBlock, error) {
+	key := ownerCursorKey(contract)
+
+	var cursor model.LatestBlock
+	result := handler.db.DB.Where(model.LatestBlock{CrawlKey: key}).Limit(1).Find(&cursor)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return &cursor, nil
+	}
+
+	cursor = model.LatestBlock{CrawlKey: key}
+	var snapshot bool
+	err := handler.db.DB.Transaction(func(tx *gorm.DB) error {
+		generation, err := handler.ownerGeneration(tx, contract.ContractID)
+		if err != nil {
+			return err
+		}
+		snapshot = generation.Block > 0
+		if snapshot {
+			cursor.LatestBlockNumber = generation.Block
+			return tx.Create(&cursor).Error
+		}
+		if contract.FromBlock > 0 {
+			cursor.LatestBlockNumber = contract.FromBlock - 1
+		}
+		err = handler.deleteOwnerGenerations(tx.Where("generation = ?", generation.Active), contract.ContractID)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&cursor).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if snapshot {
+		handler.log.Info("owners of ", contract.Address, " follow transfers from block ", cursor.LatestBlockNumber+1, " on top of the snapshot")
+	} else {
+		handler.log.Info("owners of ", contract.Address, " built from transfers starting at block ", cursor.LatestBlockNumber+1)
+	}
+	return &cursor, nil
+}
+
+// setOwnerCursor moves the transfer cursor of contract to block, backwards if need be.
+func (handler *Handler) setOwnerCursor(tx *gorm.DB, contract *model.Contract, block uint64) error {
+	cursor := model.LatestBlock{CrawlKey: ownerCursorKey(contract), LatestBlockNumber: block}
+	err := tx.Where(model.LatestBlock{CrawlKey: cursor.CrawlKey}).FirstOrCreate(&cursor).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&model.LatestBlock{}).Where("crawl_key = ?", cursor.CrawlKey).Update("latest_block_number", block).Error
+}
+
+func ownerCursorKey(contract *model.Contract) string {
+	return fmt.Sprintf("owners_%s", common.HexToAddress(contract.Address).Hex())
+}
+
+// confirmedNFTHead returns the confirmed head of the chain of contract, 0 for a contract without
+// an RPC, whose owners are not followed from transfers.
+func (handler *Handler) confirmedNFTHead(ctx context.Context, contract *model.Contract) (uint64, error) {
+	if contract.RpcUrl == "" && contract.ChainID == 0 {
+		return 0, nil
+	}
+	rpcUrl, err := handler.nftRPCURL(contract)
+	if err != nil {
+		return 0, err
+	}
+	client, err := ethclient.DialContext(ctx, rpcUrl)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to the %s chain: %w", contract.Chain, err)
+	}
+	defer client.Close()
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if head < DEFAULT_BLOCK_CONFIRM {
+		return 0, nil
+	}
+	return head - DEFAULT_BLOCK_CONFIRM, nil
+}
+
+// addOwnerBalance applies a balance delta to one owner row of the active snapshot, removing the
+// row once it reaches zero.
+func (handler *Handler) addOwnerBalance(tx *gorm.DB, contract *model.Contract, address common.Address, tokenId *big.Int, delta *big.Int) error {
+	if address == (common.Address{}) {
+		// mint or burn
+		return nil
+	}
+	generation, err := handler.activeOwnerGeneration(tx, contract.ContractID)
+	if err != nil {
+		return err
+	}
+	owner := model.Owner{
+		ContractID: contract.ContractID,
+		Address:    ownerAddress(address),
+		TokenId:    tokenId.String(),
+		TokenType:  contract.TokenType,
+		Generation: generation,
+	}
+	var rows []model.Owner
+	err = tx.Where("lower(address) = ? AND token_id = ? AND contract_id = ? AND generation = ?", owner.Address, owner.TokenId, owner.ContractID, generation).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	balance := new(big.Int)
+	for _, row := range rows {
+		rowBalance, ok := new(big.Int).SetString(row.Balance, 10)
+		if ok {
+			balance.Add(balance, rowBalance)
+		}
+	}
+	balance.Add(balance, delta)
+
+	err = tx.Where("lower(address) = ? AND token_id = ? AND contract_id = ? AND generation = ?", owner.Address, owner.TokenId, owner.ContractID, generation).Delete(&model.Owner{}).Error
+	if err != nil {
+		return err
+	}
+	if balance.Sign() <= 0 {
+		return nil
+	}
+	owner.Balance = balance.String()
+	return tx.Create(&owner).Error
+}
+
+// fetchMissingNFTs loads metadata for received tokens the nfts table does not know yet.
+func (handler *Handler) fetchMissingNFTs(ctx context.Context, contract *model.Contract, received map[string][]string) {
+	for owner, tokenIds := range received {
+		var count int64
+		err := handler.db.DB.Model(&model.NFT{}).Where("token_id IN ? AND contract_id = ?", tokenIds, contract.ContractID).Distinct("token_id").Count(&count).Error
+		if err != nil {
+			handler.log.Error("Failed to look up NFTs: ", err)
+			continue
+		}
+		if count >= int64(len(uniqueStrings(tokenIds))) {
+			continue
+		}
+		err = handler.getNFTsForOwner(ctx, contract, owner)
+		if err != nil {
+			handler.log.Error("Failed to get NFTs for owner ", owner, ": ", err)
+		}
+	}
+}
+
+// ownerAddress is the owner table form of an address, lowercase like the Alchemy responses.
+func ownerAddress(address common.Address) string {
+	return strings.ToLower(address.Hex())
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,476 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"sushi/model"
+	"sushi/utils/DB"
+	"sushi/utils/DB/dbtest"
+	"sushi/utils/config"
+	"sushi/utils/custom_errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const testContractAddress = "0x00000000000000000000000000000000000c0de1"
+
+func newTestHandler(t *testing.T, indexer Indexer) *Handler {
+	t.Helper()
+	db := dbtest.Open(t, &model.Contract{}, &model.Owner{}, &model.OwnerGeneration{}, &model.LatestBlock{})
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return &Handler{
+		db:      &DB.DB{DB: db},
+		log:     log,
+		conf:    &config.Config{},
+		indexer: indexer,
+	}
+}
+
+func testContract(t *testing.T, handler *Handler) *model.Contract {
+	t.Helper()
+	contract := model.Contract{ContractID: 1, Address: testContractAddress, TokenType: "ERC1155", Tracked: true}
+	err := handler.db.DB.Create(&contract).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &contract
+}
+
+// ownerBalances returns the owners of the active generation as "address/token" → balance.
+func ownerBalances(t *testing.T, handler *Handler, contract *model.Contract) map[string]string {
+	t.Helper()
+	generation, err := handler.activeOwnerGeneration(handler.db.DB, contract.ContractID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var owners []model.Owner
+	err = handler.db.DB.Where("contract_id = ? AND generation = ?", contract.ContractID, generation).Find(&owners).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	balances := make(map[string]string)
+	for _, owner := range owners {
+		balances[strings.ToLower(owner.Address)+"/"+owner.TokenId] = owner.Balance
+	}
+	return balances
+}
+
+func TestAddOwnerBalance(t *testing.T) {
+	aliceKey := strings.ToLower(alice.Hex())
+	bobKey := strings.ToLower(bob.Hex())
+
+	type delta struct {
+		address common.Address
+		tokenId int64
+		amount  int64
+	}
+	tests := []struct {
+		name     string
+		snapshot []model.Owner
+		deltas   []delta
+		balances map[string]string
+	}{
+		{
+			name:     "new owner",
+			deltas:   []delta{{bob, 1, 5}},
+			balances: map[string]string{bobKey + "/1": "5"},
+		},
+		{
+			name:     "adds to the snapshot",
+			snapshot: []model.Owner{{Address: alice.Hex(), TokenId: "1", Balance: "3"}},
+			deltas:   []delta{{alice, 1, 2}},
+			balances: map[string]string{aliceKey + "/1": "5"},
+		},
+		{
+			name:     "transfer moves the balance",
+			snapshot: []model.Owner{{Address: aliceKey, TokenId: "1", Balance: "3"}},
+			deltas:   []delta{{alice, 1, -1}, {bob, 1, 1}},
+			balances: map[string]string{aliceKey + "/1": "2", bobKey + "/1": "1"},
+		},
+		{
+			name:     "zero balance removes the row",
+			snapshot: []model.Owner{{Address: aliceKey, TokenId: "1", Balance: "1"}, {Address: aliceKey, TokenId: "2", Balance: "1"}},
+			deltas:   []delta{{alice, 1, -1}},
+			balances: map[string]string{aliceKey + "/2": "1"},
+		},
+		{
+			name:     "duplicate rows are merged",
+			snapshot: []model.Owner{{Address: alice.Hex(), TokenId: "1", Balance: "2"}, {Address: aliceKey, TokenId: "1", Balance: "3"}},
+			deltas:   []delta{{alice, 1, 1}},
+			balances: map[string]string{aliceKey + "/1": "6"},
+		},
+		{
+			name:     "mint and burn address is skipped",
+			deltas:   []delta{{common.Address{}, 1, -1}, {bob, 1, 1}},
+			balances: map[string]string{bobKey + "/1": "1"},
+		},
+		{
+			name:     "negative balance removes the row",
+			snapshot: []model.Owner{{Address: aliceKey, TokenId: "1", Balance: "1"}},
+			deltas:   []delta{{alice, 1, -2}},
+			balances: map[string]string{},
+		},
+		{
+			name: "other generations are left alone",
+			snapshot: []model.Owner{
+				{Address: aliceKey, TokenId: "1", Balance: "1"},
+				{Address: aliceKey, TokenId: "1", Balance: "9", Generation: 1},
+			},
+			deltas:   []delta{{alice, 1, 1}},
+			balances: map[string]string{aliceKey + "/1": "2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newTestHandler(t, nil)
+			contract := testContract(t, handler)
+			for _, owner := range test.snapshot {
+				owner.ContractID = contract.ContractID
+				owner.TokenType = contract.TokenType
+				err := handler.db.DB.Create(&owner).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, delta := range test.deltas {
+				err := handler.db.DB.Transaction(func(tx *gorm.DB) error {
+					return handler.addOwnerBalance(tx, contract, delta.address, big.NewInt(delta.tokenId), big.NewInt(delta.amount))
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			balances := ownerBalances(t, handler, contract)
+			if len(balances) != len(test.balances) {
+				t.Fatalf("balances = %v, want %v", balances, test.balances)
+			}
+			for key, balance := range test.balances {
+				if balances[key] != balance {
+					t.Fatalf("balances = %v, want %v", balances, test.balances)
+				}
+			}
+		})
+	}
+}
+
+func writeIndexerFile(t *testing.T, path string, block uint64, owners map[string]map[string]string) {
+	t.Helper()
+	addresses := make([]string, 0, len(owners))
+	for address := range owners {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	contract := indexerContract{BlockNumber: block}
+	for _, address := range addresses {
+		owner := OwnerResponse{OwnerAddress: address}
+		for tokenId, balance := range owners[address] {
+			owner.TokenBalances = append(owner.TokenBalances, TokenBalance{TokenId: tokenId, Balance: balance})
+		}
+		contract.Owners = append(contract.Owners, owner)
+	}
+	body, err := json.Marshal(indexerFile{testContractAddress: contract})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, body, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOwnerGenerationSwap(t *testing.T) {
+	aliceKey := strings.ToLower(alice.Hex())
+	bobKey := strings.ToLower(bob.Hex())
+
+	tests := []struct {
+		name string
+		// owners served by the indexer on each crawl, nil for a failing crawl
+		crawls []map[string]map[string]string
+		// active generation, its block and its balances after the last crawl
+		generation uint64
+		block      uint64
+		balances   map[string]string
+	}{
+		{
+			name:       "first crawl",
+			crawls:     []map[string]map[string]string{{aliceKey: {"1": "2", "2": "1"}}},
+			generation: 1,
+			block:      100,
+			balances:   map[string]string{aliceKey + "/1": "2", aliceKey + "/2": "1"},
+		},
+		{
+			name: "second crawl replaces the snapshot",
+			crawls: []map[string]map[string]string{
+				{aliceKey: {"1": "2"}},
+				{bobKey: {"1": "2"}},
+			},
+			generation: 2,
+			block:      200,
+			balances:   map[string]string{bobKey + "/1": "2"},
+		},
+		{
+			name: "failed crawl keeps the snapshot",
+			crawls: []map[string]map[string]string{
+				{aliceKey: {"1": "2"}},
+				nil,
+			},
+			generation: 1,
+			block:      100,
+			balances:   map[string]string{aliceKey + "/1": "2"},
+		},
+		{
+			name: "crawl after a failure",
+			crawls: []map[string]map[string]string{
+				{aliceKey: {"1": "2"}},
+				nil,
+				{aliceKey: {"1": "1"}, bobKey: {"1": "1"}},
+			},
+			generation: 2,
+			block:      300,
+			balances:   map[string]string{aliceKey + "/1": "1", bobKey + "/1": "1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "indexer.json")
+			handler := newTestHandler(t, NewFileIndexer(path))
+			contract := testContract(t, handler)
+
+			for i, owners := range test.crawls {
+				if owners == nil {
+					os.Remove(path)
+					err := handler.getOwnersForContract(context.Background(), contract)
+					if err == nil {
+						t.Fatalf("crawl %d: getOwnersForContract() succeeded without an indexer file", i+1)
+					}
+					continue
+				}
+				writeIndexerFile(t, path, uint64(100*(i+1)), owners)
+				err := handler.getOwnersForContract(context.Background(), contract)
+				if err != nil {
+					t.Fatalf("crawl %d: %v", i+1, err)
+				}
+			}
+
+			generation, err := handler.ownerGeneration(handler.db.DB, contract.ContractID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if generation.Active != test.generation || generation.Block != test.block {
+				t.Fatalf("active generation = %d at block %d, want %d at block %d", generation.Active, generation.Block, test.generation, test.block)
+			}
+			var count int64
+			err = handler.db.DB.Model(&model.Owner{}).Where("generation <> ?", generation.Active).Count(&count).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count > 0 {
+				t.Fatalf("%d owners left in other generations", count)
+			}
+			balances := ownerBalances(t, handler, contract)
+			if len(balances) != len(test.balances) {
+				t.Fatalf("balances = %v, want %v", balances, test.balances)
+			}
+			for key, balance := range test.balances {
+				if balances[key] != balance {
+					t.Fatalf("balances = %v, want %v", balances, test.balances)
+				}
+			}
+		})
+	}
+}
+
+func TestOwnerCursorStart(t *testing.T) {
+	aliceKey := strings.ToLower(alice.Hex())
+
+	tests := []struct {
+		name      string
+		fromBlock uint64
+		crawled   bool
+		block     uint64 // reported by the indexer
+		cursor    uint64
+		balances  map[string]string
+	}{
+		{
+			name:      "no snapshot",
+			fromBlock: 50,
+			cursor:    49,
+			balances:  map[string]string{},
+		},
+		{
+			name:      "snapshot block",
+			fromBlock: 50,
+			crawled:   true,
+			block:     700,
+			cursor:    700,
+			balances:  map[string]string{aliceKey + "/1": "2"},
+		},
+		{
+			name:      "snapshot without a block",
+			fromBlock: 50,
+			crawled:   true,
+			cursor:    49,
+			balances:  map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "indexer.json")
+			handler := newTestHandler(t, NewFileIndexer(path))
+			contract := testContract(t, handler)
+			contract.FromBlock = test.fromBlock
+
+			if test.crawled {
+				writeIndexerFile(t, path, test.block, map[string]map[string]string{aliceKey: {"1": "2"}})
+				err := handler.getOwnersForContract(context.Background(), contract)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cursor, err := handler.getOwnerCursor(contract)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cursor.LatestBlockNumber != test.cursor {
+				t.Fatalf("cursor = %d, want %d", cursor.LatestBlockNumber, test.cursor)
+			}
+			balances := ownerBalances(t, handler, contract)
+			if len(balances) != len(test.balances) {
+				t.Fatalf("balances = %v, want %v", balances, test.balances)
+			}
+			for key, balance := range test.balances {
+				if balances[key] != balance {
+					t.Fatalf("balances = %v, want %v", balances, test.balances)
+				}
+			}
+
+			// an existing cursor is kept
+			cursor, err = handler.getOwnerCursor(contract)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cursor.LatestBlockNumber != test.cursor {
+				t.Fatalf("second cursor = %d, want %d", cursor.LatestBlockNumber, test.cursor)
+			}
+		})
+	}
+}
+
+// hookIndexer runs duringCrawl while the owners are being read, before the snapshot is swapped in.
+type hookIndexer struct {
+	*FileIndexer
+	duringCrawl func()
+}
+
+func (indexer *hookIndexer) GetOwnersForContract(ctx context.Context, contract *model.Contract, pageKey *string) (*GetOwnersForContractResponse, error) {
+	if indexer.duringCrawl != nil {
+		indexer.duringCrawl()
+	}
+	return indexer.FileIndexer.GetOwnersForContract(ctx, contract, pageKey)
+}
+
+func transferLog(from common.Address, to common.Address, tokenId int64, block uint64) types.Log {
+	return types.Log{
+		Topics:      []common.Hash{nftABI.Events["Transfer"].ID, addressTopic(from), addressTopic(to), common.BigToHash(big.NewInt(tokenId))},
+		BlockNumber: block,
+	}
+}
+
+func TestTransferDuringCrawl(t *testing.T) {
+	aliceKey := strings.ToLower(alice.Hex())
+	bobKey := strings.ToLower(bob.Hex())
+	// alice sends token 1 to bob at block 120, synced in blocks 101-130 while the crawl runs
+	transfer := transferLog(alice, bob, 1, 120)
+
+	tests := []struct {
+		name string
+		// snapshot the crawl reads and the block the indexer reports for it
+		owners map[string]map[string]string
+		block  uint64
+		cursor uint64
+	}{
+		{
+			name:   "snapshot before the transfer",
+			owners: map[string]map[string]string{aliceKey: {"1": "1"}},
+			block:  110,
+			cursor: 110,
+		},
+		{
+			name:   "snapshot after the transfer",
+			owners: map[string]map[string]string{bobKey: {"1": "1"}},
+			block:  125,
+			cursor: 125,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "indexer.json")
+			indexer := &hookIndexer{FileIndexer: NewFileIndexer(path)}
+			handler := newTestHandler(t, indexer)
+			contract := testContract(t, handler)
+
+			writeIndexerFile(t, path, 100, map[string]map[string]string{aliceKey: {"1": "1"}})
+			err := handler.getOwnersForContract(context.Background(), contract)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor, err := handler.getOwnerCursor(contract)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writeIndexerFile(t, path, test.block, test.owners)
+			indexer.duringCrawl = func() {
+				_, err := handler.applyOwnerTransfers(cursor.CrawlKey, contract, 101, 130, []types.Log{transfer})
+				if err != nil {
+					t.Error(err)
+				}
+			}
+			err = handler.getOwnersForContract(context.Background(), contract)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the sync goes on where it left off, which the swap moved
+			_, err = handler.applyOwnerTransfers(cursor.CrawlKey, contract, 131, 140, nil)
+			if !errors.Is(err, custom_errors.OWNER_CURSOR_MOVED_ERROR) {
+				t.Fatalf("applyOwnerTransfers() after the swap = %v, want OWNER_CURSOR_MOVED_ERROR", err)
+			}
+			cursor, err = handler.getOwnerCursor(contract)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cursor.LatestBlockNumber != test.cursor {
+				t.Fatalf("cursor = %d, want %d", cursor.LatestBlockNumber, test.cursor)
+			}
+			var logs []types.Log
+			if transfer.BlockNumber > cursor.LatestBlockNumber {
+				logs = append(logs, transfer)
+			}
+			_, err = handler.applyOwnerTransfers(cursor.CrawlKey, contract, cursor.LatestBlockNumber+1, 140, logs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			balances := ownerBalances(t, handler, contract)
+			want := map[string]string{bobKey + "/1": "1"}
+			if len(balances) != len(want) || balances[bobKey+"/1"] != "1" {
+				t.Fatalf("balances = %v, want %v", balances, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"sushi/model"
+	"time"
+)
+
+const PLAYER_PURGE_SCHEDULE = "@daily"
+
+// PurgeDeletedPlayers deletes the wallet history deleted players keep for the unlink cooldown
+// once it is over, and the addresses of their withdrawals settled since the deletion.
+func (handler *Handler) PurgeDeletedPlayers(ctx context.Context) error {
+	deleted := handler.db.DB.Model(&model.Player{}).Select("user_id").Where("anonymised_at IS NOT NULL")
+	cooldown := time.Now().Add(-time.Duration(handler.conf.WalletUnlinkCooldown()) * time.Second)
+
+	result := handler.db.DB.WithContext(ctx).
+		Where("user_id IN (?) AND created_at < ?", deleted, cooldown).
+		Delete(&model.WalletHistory{})
+	if result.Error != nil {
+		return result.Error
+	}
+	purged := int(result.RowsAffected)
+
+	result = handler.db.DB.WithContext(ctx).Model(&model.WithdrawRecord{}).
+		Where("user_id IN (?) AND state NOT IN (0, 1) AND address <> ''", deleted).
+		Update("address", "")
+	if result.Error != nil {
+		return result.Error
+	}
+	purged += int(result.RowsAffected)
+
+	processed(ctx, purged)
+	if purged > 0 {
+		handler.log.Info("purged ", purged, " wallet rows of deleted players")
+	}
+	return nil
+}
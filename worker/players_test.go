@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"sushi/model"
+	"sushi/utils/DB"
+	"sushi/utils/DB/dbtest"
+	"sushi/utils/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPurgeDeletedPlayers(t *testing.T) {
+	db := dbtest.Open(t, &model.Player{}, &model.WalletHistory{}, &model.WithdrawRecord{})
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	handler := &Handler{db: &DB.DB{DB: db}, log: log, conf: &config.Config{}}
+
+	now := time.Now()
+	expired := now.Add(-time.Duration(handler.conf.WalletUnlinkCooldown())*time.Second - time.Hour)
+	players := []model.Player{
+		{UserId: 1, Sub: "live"},
+		{UserId: 2, Sub: "deleted:2", AnonymisedAt: &expired},
+	}
+	history := []model.WalletHistory{
+		{UserID: 1, Address: "0x1", Action: model.WalletUnlinked, CreatedAt: expired},
+		{UserID: 2, Address: "0x2", Action: model.WalletUnlinked, CreatedAt: expired},
+		{UserID: 2, Address: "0x3", Action: model.WalletUnlinked, CreatedAt: now},
+	}
+	withdrawals := []model.WithdrawRecord{
+		{UserID: 1, Address: "0x1", State: 2},
+		{UserID: 2, Address: "0x2", State: 2},
+		{UserID: 2, Address: "0x2", State: 1},
+	}
+	for _, rows := range []interface{}{&players, &history, &withdrawals} {
+		err := db.Create(rows).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := handler.PurgeDeletedPlayers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var addresses []string
+	err = db.Model(&model.WalletHistory{}).Order("address").Pluck("address", &addresses).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 2 || addresses[0] != "0x1" || addresses[1] != "0x3" {
+		t.Fatalf("wallet history = %v, want the live player's and the unexpired unlink", addresses)
+	}
+	var records []model.WithdrawRecord
+	err = db.Order("withdraw_id").Find(&records).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0x1", "", "0x2"}
+	for i, record := range records {
+		if record.Address != want[i] {
+			t.Fatalf("withdrawal %d address = %q, want %q", record.WithdrawId, record.Address, want[i])
+		}
+	}
+}
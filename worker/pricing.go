@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"fmt"
+	"math/big"
+	"sushi/model"
+	"sushi/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+// credit is what a payment buys: a duration, or the reason it buys nothing.
+type credit struct {
+	duration     uint64
+	rejectReason string
+}
+
+func (c credit) credited() bool {
+	return c.rejectReason == ""
+}
+
+// priceCredit prices a payment of amount in token on network. Amounts above the minimum buy
+// a proportionally longer duration.
+func (handler *Handler) priceCredit(tx *gorm.DB, network *model.Network, token common.Address, amount *big.Int) (credit, error) {
+	var price model.Price
+	result := tx.Where("chain_id = ? AND lower(token_address) = lower(?)", network.ChainID, token.Hex()).Limit(1).Find(&price)
+	if result.Error != nil {
+		return credit{}, result.Error
+	}
+	minAmount, ok := utils.ParseAmount(price.MinAmount)
+	if result.RowsAffected == 0 || !ok || minAmount.Sign() == 0 {
+		return credit{rejectReason: fmt.Sprintf("token %s is not accepted", token.Hex())}, nil
+	}
+	if amount == nil || amount.Cmp(minAmount) < 0 {
+		return credit{rejectReason: fmt.Sprintf("amount %s is below the minimum %s", amount, minAmount)}, nil
+	}
+
+	duration := new(big.Int).SetUint64(price.Duration)
+	duration.Mul(duration, amount).Div(duration, minAmount)
+	if !duration.IsUint64() {
+		return credit{rejectReason: fmt.Sprintf("amount %s is out of range", amount)}, nil
+	}
+	return credit{duration: duration.Uint64()}, nil
+}
+
+// setMinAmount updates the minimum amount of a token, creating its price with the default
+// duration of nft_expiry_time if the token had none.
+func (handler *Handler) setMinAmount(tx *gorm.DB, network *model.Network, token common.Address, minAmount *big.Int) error {
+	var price model.Price
+	result := tx.Where("chain_id = ? AND lower(token_address) = lower(?)", network.ChainID, token.Hex()).Limit(1).Find(&price)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return tx.Create(&model.Price{
+			ChainID:      network.ChainID,
+			TokenAddress: token.Hex(),
+			MinAmount:    minAmount.String(),
+			Duration:     uint64(handler.conf.NFTExpiryTime()),
+		}).Error
+	}
+	return tx.Model(&model.Price{}).
+		Where("chain_id = ? AND token_address = ?", price.ChainID, price.TokenAddress).
+		Update("min_amount", minAmount.String()).Error
+}
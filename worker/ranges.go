@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	MIN_BLOCK_PER_QUERY = 1
+	LOG_QUERY_TIMEOUT   = 30 * time.Second
+)
+
+// rangeSizer sizes eth_getLogs block ranges: halved when the provider rejects a range as too
+// large or times out, doubled back up to AVG_BLOCK_PER_QUERY after each successful range.
+type rangeSizer struct {
+	mu   sync.Mutex
+	size uint64
+}
+
+func newRangeSizer() *rangeSizer {
+	return &rangeSizer{size: AVG_BLOCK_PER_QUERY}
+}
+
+// end returns the last block of the range starting at fromBlock, capped at head.
+func (sizer *rangeSizer) end(fromBlock uint64, head uint64) uint64 {
+	toBlock := fromBlock + sizer.Size() - 1
+	if toBlock > head {
+		return head
+	}
+	return toBlock
+}
+
+func (sizer *rangeSizer) Size() uint64 {
+	sizer.mu.Lock()
+	defer sizer.mu.Unlock()
+	return sizer.size
+}
+
+// shrink halves the range, returning false if it is already a single block.
+func (sizer *rangeSizer) shrink() bool {
+	sizer.mu.Lock()
+	defer sizer.mu.Unlock()
+	if sizer.size <= MIN_BLOCK_PER_QUERY {
+		return false
+	}
+	sizer.size /= 2
+	return true
+}
+
+func (sizer *rangeSizer) grow() {
+	sizer.mu.Lock()
+	defer sizer.mu.Unlock()
+	sizer.size *= 2
+	if sizer.size > AVG_BLOCK_PER_QUERY {
+		sizer.size = AVG_BLOCK_PER_QUERY
+	}
+}
+
+// filterLogs runs one eth_getLogs query with LOG_QUERY_TIMEOUT.
+func filterLogs(ctx context.Context, client *ethclient.Client, query ethereum.FilterQuery) ([]types.Log, error) {
+	ctx, cancel := context.WithTimeout(ctx, LOG_QUERY_TIMEOUT)
+	defer cancel()
+	return client.FilterLogs(ctx, query)
+}
+
+// isRangeError reports whether a failed log query may succeed over a smaller range. Providers
+// word their limits differently, so the error text is matched.
+func isRangeError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		// the caller is stopping, not a provider limit
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, limit := range []string{
+		"more than",
+		"too many",
+		"limit exceeded",
+		"range too large",
+		"block range",
+		"response size",
+		"response too large",
+		"timeout",
+		"timed out",
+	} {
+		if strings.Contains(message, limit) {
+			return true
+		}
+	}
+	return false
+}
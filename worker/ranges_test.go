@@ -0,0 +1,72 @@
+package worker
+
+import "testing"
+
+func TestRangeSizer(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string // s: shrink, g: grow
+		size uint64
+	}{
+		{"initial", "", AVG_BLOCK_PER_QUERY},
+		{"shrink halves", "s", AVG_BLOCK_PER_QUERY / 2},
+		{"shrink twice", "ss", AVG_BLOCK_PER_QUERY / 4},
+		{"grow doubles back", "ssg", AVG_BLOCK_PER_QUERY / 2},
+		{"grow is capped", "sggg", AVG_BLOCK_PER_QUERY},
+		{"grow from full", "g", AVG_BLOCK_PER_QUERY},
+		{"shrink stops at one block", "ssssssssssssssssssss", MIN_BLOCK_PER_QUERY},
+		{"grow from one block", "ssssssssssssssssssssg", 2 * MIN_BLOCK_PER_QUERY},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sizer := newRangeSizer()
+			for _, op := range test.ops {
+				switch op {
+				case 's':
+					sizer.shrink()
+				case 'g':
+					sizer.grow()
+				}
+			}
+			if got := sizer.Size(); got != test.size {
+				t.Fatalf("Size() = %d after %q, want %d", got, test.ops, test.size)
+			}
+		})
+	}
+}
+
+func TestRangeSizerShrinkAtMinimum(t *testing.T) {
+	sizer := newRangeSizer()
+	for i := 0; sizer.shrink(); i++ {
+		if i > 64 {
+			t.Fatal("shrink() never stops")
+		}
+	}
+	if sizer.Size() != MIN_BLOCK_PER_QUERY {
+		t.Fatalf("Size() = %d, want %d", sizer.Size(), MIN_BLOCK_PER_QUERY)
+	}
+	if sizer.shrink() {
+		t.Fatal("shrink() = true at the minimum")
+	}
+}
+
+func TestRangeSizerEnd(t *testing.T) {
+	sizer := newRangeSizer()
+	tests := []struct {
+		name      string
+		fromBlock uint64
+		head      uint64
+		end       uint64
+	}{
+		{"full range", 100, 1000000, 100 + AVG_BLOCK_PER_QUERY - 1},
+		{"capped at head", 100, 500, 500},
+		{"single block", 500, 500, 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sizer.end(test.fromBlock, test.head); got != test.end {
+				t.Fatalf("end(%d, %d) = %d, want %d", test.fromBlock, test.head, got, test.end)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"errors"
+	"sushi/utils"
+	"sushi/utils/custom_errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NewRouter(worker *Worker) *gin.Engine {
+	gin.SetMode(worker.config.GinMode())
+	r := gin.Default()
+
+	r.GET("/ping", worker.HandlePing)
+	r.GET("/status", worker.HandleStatus)
+	r.POST("/owners/sync", worker.HandleTriggerOwnerSync)
+	r.POST("/payments/resync", worker.HandleResyncPayments)
+	r.POST("/jobs/:name/pause", worker.HandlePauseJob)
+	r.POST("/jobs/:name/resume", worker.HandleResumeJob)
+	return r
+}
+
+type Status struct {
+	Jobs     []JobStatus    `json:"jobs"`
+	Crawlers []CrawlerState `json:"crawlers"`
+}
+
+type ResyncJson struct {
+	ChainID   int64  `json:"chain_id"`
+	FromBlock uint64 `json:"from_block"`
+}
+
+func (worker *Worker) HandlePing(c *gin.Context) {
+	utils.SuccessResponse(c, "pong", "")
+}
+
+func (worker *Worker) HandleStatus(c *gin.Context) {
+	status := Status{
+		Jobs:     worker.supervisor.Status(),
+		Crawlers: worker.handler.CrawlerStates(),
+	}
+	utils.SuccessResponse(c, "", status)
+}
+
+func (worker *Worker) HandleTriggerOwnerSync(c *gin.Context) {
+	if worker.supervisor.IsPaused(OWNER_SYNC_JOB) {
+		utils.ErrorResponse(c, 409, custom_errors.JOB_PAUSED_ERROR.Error(), "")
+		return
+	}
+	if worker.supervisor.IsRunning(OWNER_SYNC_JOB) {
+		utils.ErrorResponse(c, 409, custom_errors.JOB_RUNNING_ERROR.Error(), "")
+		return
+	}
+	go worker.runOwnerSync()
+	utils.SuccessResponse(c, "owner sync started", "")
+}
+
+func (worker *Worker) HandleResyncPayments(c *gin.Context) {
+	var json ResyncJson
+	if err := c.ShouldBindJSON(&json); err != nil {
+		utils.ErrorResponse(c, 401, custom_errors.BIND_JSON_ERROR.Error(), "")
+		return
+	}
+	if json.ChainID == 0 || json.FromBlock == 0 {
+		utils.ErrorResponse(c, 401, "chain_id and from_block are required", "")
+		return
+	}
+	err := worker.handler.ResyncPayments(json.ChainID, json.FromBlock)
+	if errors.Is(err, custom_errors.NETWORK_NOT_FOUND_ERROR) {
+		utils.ErrorResponse(c, 404, err.Error(), "")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, 501, err.Error(), "")
+		return
+	}
+	utils.SuccessResponse(c, "", "")
+}
+
+func (worker *Worker) HandlePauseJob(c *gin.Context) {
+	err := worker.supervisor.Pause(c.Param("name"))
+	if err != nil {
+		handleJobError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", "")
+}
+
+func (worker *Worker) HandleResumeJob(c *gin.Context) {
+	err := worker.supervisor.Resume(c.Param("name"))
+	if err != nil {
+		handleJobError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, "", "")
+}
+
+func handleJobError(c *gin.Context, err error) {
+	if errors.Is(err, custom_errors.JOB_NOT_FOUND_ERROR) {
+		utils.ErrorResponse(c, 404, err.Error(), "")
+		return
+	}
+	utils.ErrorResponse(c, 501, err.Error(), "")
+}
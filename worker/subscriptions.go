@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"sushi/model"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+// nftKey is a token of an NFT contract, what payments and subscriptions are keyed by.
+type nftKey struct {
+	ChainID         int64
+	ContractAddress string
+	TokenID         string
+}
+
+// paidNFT returns the token tokenId of the NFT contract payments on network unlock: the
+// network's nft_contract_address, or the configured nft_contract_address without one. The
+// chain is the one of the tracked contract, the network's when it has none.
+func (handler *Handler) paidNFT(tx *gorm.DB, network *model.Network, tokenId string) (nftKey, error) {
+	address := network.NFTContractAddress
+	if address == "" {
+		address = handler.conf.NFTContractAddress()
+	}
+	if !common.IsHexAddress(address) {
+		return nftKey{}, fmt.Errorf("network %s has no nft_contract_address", network.Name)
+	}
+	key := nftKey{ChainID: network.ChainID, ContractAddress: common.HexToAddress(address).Hex(), TokenID: tokenId}
+
+	var contract model.Contract
+	err := tx.Where("lower(address) = ?", strings.ToLower(address)).Limit(1).Find(&contract).Error
+	if err != nil {
+		return nftKey{}, err
+	}
+	if contract.ChainID != 0 {
+		key.ChainID = contract.ChainID
+	}
+	return key, nil
+}
+
+// subscriptionExpiry returns the expiry of payer's subscription to nft, 0 if there is none.
+func (handler *Handler) subscriptionExpiry(tx *gorm.DB, payer string, nft nftKey) (uint64, error) {
+	var subscription model.Subscription
+	result := tx.Where("payer = ? AND contract_address = ? AND token_id = ?", payer, nft.ContractAddress, nft.TokenID).Limit(1).Find(&subscription)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return subscription.ExpiryDate, nil
+}
+
+// extendFrom returns when time bought at timestamp starts: at the current expiry if the
+// subscription is still running then, at timestamp otherwise.
+func extendFrom(expiryDate uint64, timestamp uint64) uint64 {
+	if expiryDate > timestamp {
+		return expiryDate
+	}
+	return timestamp
+}
+
+// setSubscriptionExpiry creates or moves payer's subscription to nft.
+func (handler *Handler) setSubscriptionExpiry(tx *gorm.DB, payer string, nft nftKey, expiryDate uint64) error {
+	result := tx.Model(&model.Subscription{}).
+		Where("payer = ? AND contract_address = ? AND token_id = ?", payer, nft.ContractAddress, nft.TokenID).
+		Update("expiry_date", expiryDate)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	var count int64
+	err := tx.Model(&model.Subscription{}).
+		Where("payer = ? AND contract_address = ? AND token_id = ?", payer, nft.ContractAddress, nft.TokenID).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		// unchanged expiry
+		return err
+	}
+	return tx.Create(&model.Subscription{
+		Payer:           payer,
+		ChainID:         nft.ChainID,
+		ContractAddress: nft.ContractAddress,
+		TokenID:         nft.TokenID,
+		ExpiryDate:      expiryDate,
+	}).Error
+}
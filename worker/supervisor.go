@@ -0,0 +1,319 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sushi/utils/custom_errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	MIN_BACKOFF       = 2 * time.Second
+	MAX_BACKOFF       = 5 * time.Minute
+	JOB_MAX_ATTEMPTS  = 5                // attempts per run of a scheduled job
+	HEALTHY_RUN_AFTER = 10 * time.Minute // a service running this long resets its backoff
+)
+
+type JobFunc func(ctx context.Context) error
+
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Running        bool       `json:"running"`
+	Paused         bool       `json:"paused"`
+	Attempts       int        `json:"attempts"`
+	Failures       int        `json:"failures"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastDuration   string     `json:"last_duration,omitempty"`
+	ItemsProcessed int        `json:"items_processed"` // during the current or last run
+	TotalItems     int        `json:"total_items"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastErrorAt    *time.Time `json:"last_error_at,omitempty"`
+	NextRetryAt    *time.Time `json:"next_retry_at,omitempty"`
+}
+
+type jobState struct {
+	JobStatus
+	cancel  context.CancelFunc // cancels the running attempt
+	resumed chan struct{}      // closed when a paused job is resumed
+}
+
+type jobKey struct{}
+
+type jobRun struct {
+	supervisor *Supervisor
+	name       string
+}
+
+// Supervisor runs worker jobs, recovers their panics and retries failures with exponential
+// backoff, keeping a status per job for the status endpoint. A job never runs twice at once.
+type Supervisor struct {
+	log   *logrus.Logger
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
+
+	mu   sync.RWMutex
+	jobs map[string]*jobState
+}
+
+func NewSupervisor(log *logrus.Logger) *Supervisor {
+	return &Supervisor{
+		log:   log,
+		now:   time.Now,
+		sleep: sleep,
+		jobs:  make(map[string]*jobState),
+	}
+}
+
+// Register makes a job known before its first run so it can be inspected and paused.
+func (supervisor *Supervisor) Register(name string) {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+	supervisor.state(name)
+}
+
+// Go keeps a long-running job alive until ctx is done. A job that returns, fails or panics is
+// restarted after a backoff delay; a paused job is stopped and started again on resume.
+func (supervisor *Supervisor) Go(ctx context.Context, name string, job JobFunc) {
+	supervisor.Register(name)
+	go func() {
+		backoff := MIN_BACKOFF
+		for ctx.Err() == nil {
+			if !supervisor.waitResumed(ctx, name) {
+				return
+			}
+			started := supervisor.now()
+			err := supervisor.attempt(ctx, name, job)
+			if ctx.Err() != nil {
+				return
+			}
+			if supervisor.IsPaused(name) {
+				continue
+			}
+			if err == nil {
+				err = fmt.Errorf("job exited")
+			}
+			if supervisor.now().Sub(started) > HEALTHY_RUN_AFTER {
+				backoff = MIN_BACKOFF
+			}
+			supervisor.failed(name, err, backoff)
+			if !supervisor.sleep(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+		}
+	}()
+}
+
+// Run executes a one-shot job, retrying it up to JOB_MAX_ATTEMPTS times. It refuses to start
+// while the job is paused or already running.
+func (supervisor *Supervisor) Run(ctx context.Context, name string, job JobFunc) error {
+	if supervisor.IsPaused(name) {
+		return custom_errors.JOB_PAUSED_ERROR
+	}
+	backoff := MIN_BACKOFF
+	var err error
+	for attempt := 1; attempt <= JOB_MAX_ATTEMPTS; attempt++ {
+		err = supervisor.attempt(ctx, name, job)
+		if err == nil || ctx.Err() != nil || errors.Is(err, custom_errors.JOB_RUNNING_ERROR) {
+			return err
+		}
+		if supervisor.IsPaused(name) {
+			return custom_errors.JOB_PAUSED_ERROR
+		}
+		if attempt == JOB_MAX_ATTEMPTS {
+			supervisor.failed(name, err, 0)
+			break
+		}
+		supervisor.failed(name, err, backoff)
+		if !supervisor.sleep(ctx, backoff) {
+			return ctx.Err()
+		}
+		backoff = nextBackoff(backoff)
+	}
+	return err
+}
+
+// Pause stops the running attempt of a job and keeps it from starting until Resume.
+func (supervisor *Supervisor) Pause(name string) error {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+
+	state, ok := supervisor.jobs[name]
+	if !ok {
+		return custom_errors.JOB_NOT_FOUND_ERROR
+	}
+	if state.Paused {
+		return nil
+	}
+	state.Paused = true
+	state.resumed = make(chan struct{})
+	if state.cancel != nil {
+		state.cancel()
+	}
+	supervisor.log.Info("job paused: ", name)
+	return nil
+}
+
+func (supervisor *Supervisor) Resume(name string) error {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+
+	state, ok := supervisor.jobs[name]
+	if !ok {
+		return custom_errors.JOB_NOT_FOUND_ERROR
+	}
+	if !state.Paused {
+		return nil
+	}
+	state.Paused = false
+	close(state.resumed)
+	supervisor.log.Info("job resumed: ", name)
+	return nil
+}
+
+func (supervisor *Supervisor) IsPaused(name string) bool {
+	supervisor.mu.RLock()
+	defer supervisor.mu.RUnlock()
+	state, ok := supervisor.jobs[name]
+	return ok && state.Paused
+}
+
+func (supervisor *Supervisor) IsRunning(name string) bool {
+	supervisor.mu.RLock()
+	defer supervisor.mu.RUnlock()
+	state, ok := supervisor.jobs[name]
+	return ok && state.Running
+}
+
+func (supervisor *Supervisor) Status() []JobStatus {
+	supervisor.mu.RLock()
+	defer supervisor.mu.RUnlock()
+
+	statuses := make([]JobStatus, 0, len(supervisor.jobs))
+	for _, state := range supervisor.jobs {
+		status := state.JobStatus
+		if status.Running && status.LastRunAt != nil {
+			status.LastDuration = supervisor.now().Sub(*status.LastRunAt).Round(time.Second).String()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// processed adds n to the items count of the job running with ctx.
+func processed(ctx context.Context, n int) {
+	run, ok := ctx.Value(jobKey{}).(*jobRun)
+	if !ok {
+		return
+	}
+	run.supervisor.mu.Lock()
+	defer run.supervisor.mu.Unlock()
+
+	state := run.supervisor.state(run.name)
+	state.ItemsProcessed += n
+	state.TotalItems += n
+}
+
+func (supervisor *Supervisor) attempt(ctx context.Context, name string, job JobFunc) (err error) {
+	supervisor.mu.Lock()
+	state := supervisor.state(name)
+	if state.Running {
+		supervisor.mu.Unlock()
+		return custom_errors.JOB_RUNNING_ERROR
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	started := supervisor.now()
+	state.Running = true
+	state.cancel = cancel
+	state.Attempts++
+	state.LastRunAt = &started
+	state.ItemsProcessed = 0
+	state.NextRetryAt = nil
+	supervisor.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		cancel()
+
+		supervisor.mu.Lock()
+		defer supervisor.mu.Unlock()
+		state.Running = false
+		state.cancel = nil
+		state.LastDuration = supervisor.now().Sub(started).Round(time.Millisecond).String()
+	}()
+	return job(context.WithValue(ctx, jobKey{}, &jobRun{supervisor: supervisor, name: name}))
+}
+
+// waitResumed blocks while the job is paused, returning false if ctx is done first.
+func (supervisor *Supervisor) waitResumed(ctx context.Context, name string) bool {
+	supervisor.mu.RLock()
+	state := supervisor.jobs[name]
+	paused, resumed := state.Paused, state.resumed
+	supervisor.mu.RUnlock()
+
+	if !paused {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-resumed:
+		return true
+	}
+}
+
+func (supervisor *Supervisor) state(name string) *jobState {
+	state, ok := supervisor.jobs[name]
+	if !ok {
+		state = &jobState{JobStatus: JobStatus{Name: name}}
+		supervisor.jobs[name] = state
+	}
+	return state
+}
+
+func (supervisor *Supervisor) failed(name string, err error, retryIn time.Duration) {
+	supervisor.log.Errorf("job %s failed: %v", name, err)
+
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+
+	now := supervisor.now()
+	state := supervisor.state(name)
+	state.Failures++
+	state.LastError = err.Error()
+	state.LastErrorAt = &now
+	if retryIn > 0 {
+		next := now.Add(retryIn)
+		state.NextRetryAt = &next
+	}
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > MAX_BACKOFF {
+		return MAX_BACKOFF
+	}
+	return backoff
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeClock only moves when a job or the supervisor sleeps on it.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+func (clock *fakeClock) Sleep(ctx context.Context, d time.Duration) bool {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.sleeps = append(clock.sleeps, d)
+	clock.now = clock.now.Add(d)
+	return ctx.Err() == nil
+}
+
+func (clock *fakeClock) Sleeps() []time.Duration {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return append([]time.Duration(nil), clock.sleeps...)
+}
+
+func newTestSupervisor() (*Supervisor, *fakeClock) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	supervisor := NewSupervisor(log)
+	supervisor.now = clock.Now
+	supervisor.sleep = clock.Sleep
+	return supervisor, clock
+}
+
+func TestSupervisorGoBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		// runFor is how long each attempt runs, by attempt number from 1
+		runFor map[int]time.Duration
+		panics bool
+		sleeps []time.Duration
+	}{
+		{
+			name:   "doubles up to MAX_BACKOFF",
+			sleeps: []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, 64 * time.Second, 128 * time.Second, 256 * time.Second, MAX_BACKOFF, MAX_BACKOFF},
+		},
+		{
+			name:   "panics are restarted",
+			panics: true,
+			sleeps: []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second},
+		},
+		{
+			name:   "healthy run resets",
+			runFor: map[int]time.Duration{4: HEALTHY_RUN_AFTER + time.Second},
+			sleeps: []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, MIN_BACKOFF, 4 * time.Second, 8 * time.Second},
+		},
+		{
+			name:   "short run keeps backing off",
+			runFor: map[int]time.Duration{4: HEALTHY_RUN_AFTER - time.Second},
+			sleeps: []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, 64 * time.Second},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			supervisor, clock := newTestSupervisor()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan struct{})
+			attempts := 0
+			supervisor.Go(ctx, "job", func(ctx context.Context) error {
+				attempts++
+				clock.Advance(test.runFor[attempts])
+				if attempts > len(test.sleeps) {
+					// stop after the restarts under test
+					cancel()
+					close(done)
+					return nil
+				}
+				if test.panics {
+					panic("boom")
+				}
+				return errors.New("failed")
+			})
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("job was not restarted")
+			}
+
+			if got := clock.Sleeps(); !reflect.DeepEqual(got, test.sleeps) {
+				t.Fatalf("backoffs = %v, want %v", got, test.sleeps)
+			}
+			status := supervisor.Status()[0]
+			if status.Failures != len(test.sleeps) {
+				t.Fatalf("Failures = %d, want %d", status.Failures, len(test.sleeps))
+			}
+			if test.panics && !strings.HasPrefix(status.LastError, "panic: ") {
+				t.Fatalf("LastError = %q, want the panic", status.LastError)
+			}
+		})
+	}
+}
+
+func TestSupervisorRunRetries(t *testing.T) {
+	supervisor, clock := newTestSupervisor()
+	attempts := 0
+	err := supervisor.Run(context.Background(), "job", func(ctx context.Context) error {
+		attempts++
+		return errors.New("failed")
+	})
+	if err == nil || attempts != JOB_MAX_ATTEMPTS {
+		t.Fatalf("Run() = %v after %d attempts, want an error after %d", err, attempts, JOB_MAX_ATTEMPTS)
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}
+	if got := clock.Sleeps(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("backoffs = %v, want %v", got, want)
+	}
+	status := supervisor.Status()[0]
+	if status.Failures != JOB_MAX_ATTEMPTS || status.NextRetryAt != nil {
+		t.Fatalf("status = %+v, want %d failures and no retry", status, JOB_MAX_ATTEMPTS)
+	}
+}
+
+func TestSupervisorRunSucceedsAfterRetry(t *testing.T) {
+	supervisor, clock := newTestSupervisor()
+	attempts := 0
+	err := supervisor.Run(context.Background(), "job", func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second}
+	if got := clock.Sleeps(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("backoffs = %v, want %v", got, want)
+	}
+}
+
+func TestSupervisorRunPaused(t *testing.T) {
+	supervisor, clock := newTestSupervisor()
+	supervisor.Register("job")
+	err := supervisor.Pause("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = supervisor.Run(context.Background(), "job", func(ctx context.Context) error {
+		t.Fatal("paused job ran")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Run() of a paused job succeeded")
+	}
+	if len(clock.Sleeps()) != 0 {
+		t.Fatalf("backoffs = %v for a paused job", clock.Sleeps())
+	}
+}
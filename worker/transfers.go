@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NFT_ABI covers the ERC-721 and ERC-1155 transfer events and metadata getters.
+const NFT_ABI = `[
+	{"anonymous":false,"name":"Transfer","type":"event","inputs":[
+		{"indexed":true,"name":"from","type":"address"},
+		{"indexed":true,"name":"to","type":"address"},
+		{"indexed":true,"name":"tokenId","type":"uint256"}]},
+	{"anonymous":false,"name":"TransferSingle","type":"event","inputs":[
+		{"indexed":true,"name":"operator","type":"address"},
+		{"indexed":true,"name":"from","type":"address"},
+		{"indexed":true,"name":"to","type":"address"},
+		{"indexed":false,"name":"id","type":"uint256"},
+		{"indexed":false,"name":"value","type":"uint256"}]},
+	{"anonymous":false,"name":"TransferBatch","type":"event","inputs":[
+		{"indexed":true,"name":"operator","type":"address"},
+		{"indexed":true,"name":"from","type":"address"},
+		{"indexed":true,"name":"to","type":"address"},
+		{"indexed":false,"name":"ids","type":"uint256[]"},
+		{"indexed":false,"name":"values","type":"uint256[]"}]},
+	{"name":"tokenURI","type":"function","stateMutability":"view",
+		"inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+	{"name":"uri","type":"function","stateMutability":"view",
+		"inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+var nftABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(NFT_ABI))
+	if err != nil {
+		panic(any("invalid NFT_ABI, " + err.Error()))
+	}
+	return parsed
+}()
+
+// Transfer is one token movement; a mint has a zero From and a burn a zero To.
+type Transfer struct {
+	From    common.Address
+	To      common.Address
+	TokenId *big.Int
+	Amount  *big.Int
+}
+
+// transferTopics filters logs down to the NFT transfer events.
+func transferTopics() [][]common.Hash {
+	return [][]common.Hash{{
+		nftABI.Events["Transfer"].ID,
+		nftABI.Events["TransferSingle"].ID,
+		nftABI.Events["TransferBatch"].ID,
+	}}
+}
+
+// decodeTransfers returns the token movements in log. ERC-20 Transfer logs, which share the
+// ERC-721 signature but do not index the third argument, decode to nothing.
+func decodeTransfers(log types.Log) ([]Transfer, error) {
+	if len(log.Topics) != 4 {
+		return nil, nil
+	}
+
+	switch log.Topics[0] {
+	case nftABI.Events["Transfer"].ID:
+		return []Transfer{{
+			From:    common.BytesToAddress(log.Topics[1].Bytes()),
+			To:      common.BytesToAddress(log.Topics[2].Bytes()),
+			TokenId: log.Topics[3].Big(),
+			Amount:  big.NewInt(1),
+		}}, nil
+
+	case nftABI.Events["TransferSingle"].ID:
+		values, err := nftABI.Unpack("TransferSingle", log.Data)
+		if err != nil {
+			return nil, err
+		}
+		return []Transfer{{
+			From:    common.BytesToAddress(log.Topics[2].Bytes()),
+			To:      common.BytesToAddress(log.Topics[3].Bytes()),
+			TokenId: values[0].(*big.Int),
+			Amount:  values[1].(*big.Int),
+		}}, nil
+
+	case nftABI.Events["TransferBatch"].ID:
+		values, err := nftABI.Unpack("TransferBatch", log.Data)
+		if err != nil {
+			return nil, err
+		}
+		ids := values[0].([]*big.Int)
+		amounts := values[1].([]*big.Int)
+		if len(ids) != len(amounts) {
+			return nil, fmt.Errorf("TransferBatch with %d ids and %d values", len(ids), len(amounts))
+		}
+		transfers := make([]Transfer, 0, len(ids))
+		for i := range ids {
+			transfers = append(transfers, Transfer{
+				From:    common.BytesToAddress(log.Topics[2].Bytes()),
+				To:      common.BytesToAddress(log.Topics[3].Bytes()),
+				TokenId: ids[i],
+				Amount:  amounts[i],
+			})
+		}
+		return transfers, nil
+	}
+	return nil, nil
+}
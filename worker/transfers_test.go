@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	alice    = common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob      = common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	operator = common.HexToAddress("0x000000000000000000000000000000000000beef")
+)
+
+func addressTopic(address common.Address) common.Hash {
+	return common.BytesToHash(address.Bytes())
+}
+
+func packEventData(t *testing.T, name string, values ...interface{}) []byte {
+	t.Helper()
+	data, err := nftABI.Events[name].Inputs.NonIndexed().Pack(values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeTransfers(t *testing.T) {
+	transfer := nftABI.Events["Transfer"].ID
+	single := nftABI.Events["TransferSingle"].ID
+	batch := nftABI.Events["TransferBatch"].ID
+
+	tests := []struct {
+		name      string
+		log       types.Log
+		transfers []Transfer
+		err       bool
+	}{
+		{
+			name: "ERC-721 transfer",
+			log:  types.Log{Topics: []common.Hash{transfer, addressTopic(alice), addressTopic(bob), common.BigToHash(big.NewInt(7))}},
+			transfers: []Transfer{
+				{From: alice, To: bob, TokenId: big.NewInt(7), Amount: big.NewInt(1)},
+			},
+		},
+		{
+			name: "ERC-721 mint",
+			log:  types.Log{Topics: []common.Hash{transfer, {}, addressTopic(bob), common.BigToHash(big.NewInt(1))}},
+			transfers: []Transfer{
+				{From: common.Address{}, To: bob, TokenId: big.NewInt(1), Amount: big.NewInt(1)},
+			},
+		},
+		{
+			name: "ERC-20 transfer",
+			log: types.Log{
+				Topics: []common.Hash{transfer, addressTopic(alice), addressTopic(bob)},
+				Data:   common.BigToHash(big.NewInt(100)).Bytes(),
+			},
+		},
+		{
+			name: "ERC-1155 single",
+			log: types.Log{
+				Topics: []common.Hash{single, addressTopic(operator), addressTopic(alice), addressTopic(bob)},
+				Data:   packEventData(t, "TransferSingle", big.NewInt(3), big.NewInt(25)),
+			},
+			transfers: []Transfer{
+				{From: alice, To: bob, TokenId: big.NewInt(3), Amount: big.NewInt(25)},
+			},
+		},
+		{
+			name: "ERC-1155 batch",
+			log: types.Log{
+				Topics: []common.Hash{batch, addressTopic(operator), addressTopic(alice), {}},
+				Data:   packEventData(t, "TransferBatch", []*big.Int{big.NewInt(1), big.NewInt(2)}, []*big.Int{big.NewInt(10), big.NewInt(20)}),
+			},
+			transfers: []Transfer{
+				{From: alice, To: common.Address{}, TokenId: big.NewInt(1), Amount: big.NewInt(10)},
+				{From: alice, To: common.Address{}, TokenId: big.NewInt(2), Amount: big.NewInt(20)},
+			},
+		},
+		{
+			name: "ERC-1155 batch with mismatched values",
+			log: types.Log{
+				Topics: []common.Hash{batch, addressTopic(operator), addressTopic(alice), addressTopic(bob)},
+				Data:   packEventData(t, "TransferBatch", []*big.Int{big.NewInt(1), big.NewInt(2)}, []*big.Int{big.NewInt(10)}),
+			},
+			err: true,
+		},
+		{
+			name: "ERC-1155 single with bad data",
+			log: types.Log{
+				Topics: []common.Hash{single, addressTopic(operator), addressTopic(alice), addressTopic(bob)},
+				Data:   []byte{1, 2, 3},
+			},
+			err: true,
+		},
+		{
+			name: "other event",
+			log:  types.Log{Topics: []common.Hash{common.HexToHash("0x01"), {}, {}, {}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transfers, err := decodeTransfers(test.log)
+			if test.err {
+				if err == nil {
+					t.Fatalf("decodeTransfers() = %v, want an error", transfers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(transfers) == 0 && len(test.transfers) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(transfers, test.transfers) {
+				t.Fatalf("decodeTransfers() = %+v, want %+v", transfers, test.transfers)
+			}
+		})
+	}
+}
@@ -1,26 +1,41 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"sushi/utils/DB"
 	"sushi/utils/config"
+	"sushi/utils/custom_errors"
 
+	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 )
 
 type Worker struct {
-	config  *config.Config
-	log     *logrus.Logger
-	cron    *cron.Cron
-	handler *Handler
-	db      *DB.DB
+	config     *config.Config
+	log        *logrus.Logger
+	cron       *cron.Cron
+	handler    *Handler
+	db         *DB.DB
+	supervisor *Supervisor
+	router     *gin.Engine
+	ctx        context.Context
+	cancel     context.CancelFunc
 }
 
-func CreateServer() *http.Server {
+const (
+	OWNER_SYNC_JOB      = "owner_sync"
+	OWNER_TRANSFERS_JOB = "owner_transfers"
+	PAYMENT_CRAWLER_JOB = "payment_crawler"
+	PLAYER_PURGE_JOB    = "player_purge"
+)
+
+func CreateServer() (*http.Server, *Worker) {
 
 	conf, err := config.NewConfig()
 	if err != nil {
@@ -55,43 +70,112 @@ func CreateServer() *http.Server {
 	/*
 	   Initialize Handler
 	*/
-	svr.handler = NewHandler(svr)
+	svr.handler, err = NewHandler(svr)
+	if err != nil {
+		log.Fatal("failed to initialize NFT indexer: ", err)
+	}
+	err = svr.handler.seedContracts()
+	if err != nil {
+		log.Fatal("failed to seed NFT contracts: ", err)
+	}
+
+	/*
+		Initialize Supervisor
+	*/
+	svr.supervisor = NewSupervisor(log)
 
 	/*
 		Initialize Cron
 	*/
 	cron := cron.New()
-	svr.cron = NewJob(cron, svr.handler)
+	svr.cron, err = NewJob(cron, svr)
+	if err != nil {
+		log.Fatal("failed to schedule jobs: ", err)
+	}
 	svr.cron.Start()
 
-	addr := fmt.Sprintf("%s:%d", "0.0.0.0", conf.WorkerPort())
-	httpServer := makeHttpServer(addr)
-	return httpServer
+	/*
+		Initialize Router
+	*/
+	svr.router = NewRouter(svr)
+
+	addr := fmt.Sprintf("%s:%d", conf.WorkerHost(), conf.WorkerPort())
+	httpServer := makeHttpServer(addr, svr.router)
+	return httpServer, svr
+}
+
+func NewJob(cron *cron.Cron, worker *Worker) (*cron.Cron, error) {
+	handler := worker.handler
+	fmt.Println("Cron job owner consistency check every run on", handler.conf.SpecSchedule())
+	worker.supervisor.Register(OWNER_SYNC_JOB)
+	_, err := cron.AddFunc(handler.conf.SpecSchedule(), worker.runOwnerSync)
+	if err != nil {
+		return nil, err
+	}
+	worker.supervisor.Go(worker.ctx, OWNER_TRANSFERS_JOB, handler.SyncOwnersFromTransfers)
+
+	worker.supervisor.Register(PLAYER_PURGE_JOB)
+	_, err = cron.AddFunc(PLAYER_PURGE_SCHEDULE, worker.runPlayerPurge)
+	if err != nil {
+		return nil, err
+	}
+
+	networks, err := handler.getNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get networks from database: %w", err)
+	}
+	if len(networks) == 0 {
+		worker.log.Error("no payment network configured, payments are not crawled")
+	}
+	for i := range networks {
+		network := &networks[i]
+		worker.supervisor.Go(worker.ctx, paymentCrawlerJob(network.ChainID), func(ctx context.Context) error {
+			return handler.CrawlFromWeb3(ctx, network)
+		})
+	}
+	return cron, nil
+}
+
+// paymentCrawlerJob is the supervisor job name of the payment crawler of a chain.
+func paymentCrawlerJob(chainID int64) string {
+	return fmt.Sprintf("%s_%d", PAYMENT_CRAWLER_JOB, chainID)
 }
 
-func NewJob(cron *cron.Cron, handler *Handler) *cron.Cron {
-	fmt.Println("Cron job crawl nfts every run on", handler.conf.SpecSchedule())
-	cron.AddFunc(handler.conf.SpecSchedule(), handler.GetOwnersForContract)
-	handler.CrawlFromWeb3()
-	return cron
+func (worker *Worker) runOwnerSync() {
+	err := worker.supervisor.Run(worker.ctx, OWNER_SYNC_JOB, worker.handler.GetOwnersForContract)
+	if errors.Is(err, custom_errors.JOB_PAUSED_ERROR) || errors.Is(err, custom_errors.JOB_RUNNING_ERROR) {
+		worker.log.Info("owner sync skipped: ", err)
+	}
+}
+
+func (worker *Worker) runPlayerPurge() {
+	err := worker.supervisor.Run(worker.ctx, PLAYER_PURGE_JOB, worker.handler.PurgeDeletedPlayers)
+	if errors.Is(err, custom_errors.JOB_PAUSED_ERROR) || errors.Is(err, custom_errors.JOB_RUNNING_ERROR) {
+		worker.log.Info("player purge skipped: ", err)
+	}
 }
 
 func NewWorker(conf *config.Config, log *logrus.Logger) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Worker{
 		config: conf,
 		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
-func makeHttpServer(addr string) *http.Server {
+func makeHttpServer(addr string, r http.Handler) *http.Server {
 	return &http.Server{
-		Addr: addr,
+		Addr:    addr,
+		Handler: r,
 	}
 }
 
 func Start() error {
 	log.Println("worker server creating...")
-	srv := CreateServer()
+	srv, worker := CreateServer()
+	defer worker.cancel()
 	log.Println("worker server starting...")
 	err := srv.ListenAndServe()
 	if err == http.ErrServerClosed {